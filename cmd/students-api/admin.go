@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const createAdminUsage = "usage: students-api -config <file> create-admin <email> <name>, the password is read from ADMIN_PASSWORD or from the first line of stdin"
+
+// runCreateAdmin handles the create-admin subcommand. Admins can not sign up, this is how the
+// first one is made: it creates a verified admin account, or promotes the account that
+// already uses the email.
+func runCreateAdmin(ctx context.Context, storage storage.Storage, args []string, stdin io.Reader) error {
+	if len(args) != 2 {
+		return fmt.Errorf(createAdminUsage)
+	}
+
+	email, name := strings.TrimSpace(args[0]), strings.TrimSpace(args[1])
+	if err := validator.New().Var(email, "required,email"); err != nil || name == "" {
+		return fmt.Errorf(createAdminUsage)
+	}
+
+	user, err := storage.GetUserByEmail(ctx, email)
+	if err == nil {
+		if err := storage.SetUserRole(ctx, user.ID, model.RoleAdmin); err != nil {
+			return err
+		}
+		//tokens issued with the old role must not outlive the promotion for long
+		if err := storage.RevokeUserSessions(ctx, user.ID); err != nil {
+			return err
+		}
+		fmt.Printf("promoted user %d (%s) to admin\n", user.ID, user.Email)
+		return nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if len(password) < 6 {
+		return fmt.Errorf("the password needs at least 6 characters")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	//the operator vouches for the address, there is no verification email to click
+	now := time.Now().UTC()
+	id, err := storage.CreateUser(ctx, model.User{
+		Name:            name,
+		Email:           email,
+		Password:        string(hashedPassword),
+		Role:            model.RoleAdmin,
+		EmailVerifiedAt: &now,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created admin %d (%s)\n", id, email)
+	return nil
+}
@@ -2,16 +2,33 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/health"
+	"github/com/ammar-nousher-ali/students-api/internal/http/handlers/attendance"
 	"github/com/ammar-nousher-ali/students-api/internal/http/handlers/auth"
 	"github/com/ammar-nousher-ali/students-api/internal/http/handlers/course"
 	student_courses "github/com/ammar-nousher-ali/students-api/internal/http/handlers/enroll_student"
+	"github/com/ammar-nousher-ali/students-api/internal/http/handlers/grade"
+	"github/com/ammar-nousher-ali/students-api/internal/http/handlers/me"
 	"github/com/ammar-nousher-ali/students-api/internal/http/handlers/student"
+	"github/com/ammar-nousher-ali/students-api/internal/lockout"
+	"github/com/ammar-nousher-ali/students-api/internal/logger"
+	"github/com/ammar-nousher-ali/students-api/internal/mailer"
+	"github/com/ammar-nousher-ali/students-api/internal/metrics"
 	"github/com/ammar-nousher-ali/students-api/internal/middleware"
-	_ "github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/storage/migrate"
+	"github/com/ammar-nousher-ali/students-api/internal/storage/postgres"
 	"github/com/ammar-nousher-ali/students-api/internal/storage/sqlite"
+	"github/com/ammar-nousher-ali/students-api/internal/token"
+	"github/com/ammar-nousher-ali/students-api/internal/tracing"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -19,61 +36,198 @@ import (
 	"time"
 )
 
+const version = "1.0.0"
+
 func main() {
 
 	//load config
 
 	cfg := config.MustLoad()
 
+	logger, err := logger.New(cfg.Log, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	slog.SetDefault(logger)
+
+	//tracing, before the storage so its database is traced too
+
+	shutdownTracing, err := tracing.Setup(cfg.Tracing, version)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	//database setup
 
-	storage, err := sqlite.New(cfg)
+	storage, db, migrator, err := newStorage(cfg)
+	if err != nil {
+		log.Fatal(err)
+
+	}
+
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(context.Background(), migrator, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	//refuse to serve against a schema this binary does not match
+	if err := migrator.Check(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	if args := flag.Args(); len(args) > 0 && args[0] == "create-admin" {
+		if err := runCreateAdmin(context.Background(), storage, args[1:], os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	slog.Info("storage initialized", slog.String("env", cfg.Env), slog.String("driver", cfg.StorageDriver), slog.String("version", version))
+
+	//metrics
+
+	metrics := metrics.New()
+
+	if err := metrics.RegisterDB(db, cfg.StorageDriver); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := metrics.RegisterStats(storage); err != nil {
+		log.Fatal(err)
+	}
+
+	storage = metrics.InstrumentStorage(tracing.InstrumentStorage(storage))
+
+	keys, err := token.NewKeySet(cfg.JWT)
 	if err != nil {
 		log.Fatal(err)
+	}
 
+	mail, err := mailer.New(cfg.Mailer)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	slog.Info("storage initialized", slog.String("env", cfg.Env), slog.String("version", "1.0.0"))
+	guard := lockout.New(storage, cfg.Login)
+	limiter := middleware.NewRateLimiter(cfg.RateLimits, keys, cfg.JWT)
 
 	//setup router
 
 	router := http.NewServeMux()
 
+	router.Handle("GET /metrics", metrics.Handler())
+
+	//probes
+	checker := health.New(
+		health.Ping("storage", db),
+		health.Func("schema", migrator.Check),
+	)
+	router.HandleFunc("GET /healthz", checker.Live())
+	router.HandleFunc("GET /readyz", checker.Ready())
+
 	//Public routes
-	router.HandleFunc("POST /api/signup", auth.Signup(storage))
-	router.HandleFunc("POST /api/signin", auth.SignIn(storage))
+	router.HandleFunc("POST /api/signup", limiter.Limit("auth", auth.Signup(storage, mail, cfg.Accounts)))
+	router.HandleFunc("POST /api/signin", limiter.Limit("auth", auth.SignIn(storage, cfg.JWT, keys, cfg.Accounts, guard)))
+	router.HandleFunc("GET /.well-known/jwks.json", limiter.Limit("public", auth.JWKS(keys)))
+	router.HandleFunc("POST /api/token/refresh", limiter.Limit("auth", auth.Refresh(storage, cfg.JWT, keys)))
+	router.HandleFunc("POST /api/password/forgot", limiter.Limit("auth", auth.ForgotPassword(storage, mail, cfg.Accounts)))
+	router.HandleFunc("POST /api/password/reset", limiter.Limit("auth", auth.ResetPassword(storage)))
+	router.HandleFunc("POST /api/email/verify", limiter.Limit("auth", auth.VerifyEmail(storage)))
+	router.HandleFunc("POST /api/email/verify/resend", limiter.Limit("auth", auth.ResendVerification(storage, mail, cfg.Accounts)))
 
 	//Protected routes
 
+	staff := []string{model.RoleTeacher, model.RoleAdmin}
+	everyone := []string{model.RoleStudent, model.RoleTeacher, model.RoleAdmin}
+
+	//group names the rate limit buckets of the route, the limiter runs before authentication
+	//so requests with bad tokens are limited as well
+	protected := func(group string, next http.HandlerFunc, roles ...string) http.HandlerFunc {
+		return limiter.Limit(group, middleware.JWTMiddleware(storage, keys, cfg.JWT, middleware.RequireRoles(next, roles...)))
+	}
+
+	router.HandleFunc("POST /api/signout", protected("auth", auth.SignOut(storage), everyone...))
+	router.HandleFunc("POST /api/signout/all", protected("auth", auth.SignOutAll(storage), everyone...))
+	router.HandleFunc("POST /api/users/{id}/unlock", protected("auth", auth.Unlock(storage, guard), model.RoleAdmin))
+	router.HandleFunc("PUT /api/users/{id}/role", protected("auth", auth.SetRole(storage), model.RoleAdmin))
+
+	//the signed in user
+	router.HandleFunc("GET /api/me", protected("me", me.Get(storage), everyone...))
+	router.HandleFunc("GET /api/me/courses", protected("me", me.GetCourses(storage), model.RoleStudent))
+	router.HandleFunc("POST /api/me/enroll", protected("me", me.Enroll(storage), model.RoleStudent))
+
 	//students
-	router.HandleFunc("POST /api/students", middleware.JWTMiddleware(student.New(storage)))
-	router.HandleFunc("POST /api/students/batch", middleware.JWTMiddleware(student.NewBatch(storage)))
-	router.HandleFunc("GET /api/students/{id}", middleware.JWTMiddleware(student.GetById(storage)))
-	router.HandleFunc("GET /api/students", middleware.JWTMiddleware(student.GetList(storage)))
-	router.HandleFunc("DELETE /api/students/{id}", middleware.JWTMiddleware(student.DeleteStudent(storage)))
-	router.HandleFunc("PUT /api/students/{id}", middleware.JWTMiddleware(student.UpdateStudent(storage)))
-	router.HandleFunc("GET /api/students/search", middleware.JWTMiddleware(student.SearchStudent(storage)))
+	router.HandleFunc("POST /api/students", protected("students", student.New(storage), staff...))
+	router.HandleFunc("POST /api/students/batch", protected("students", student.NewBatch(storage, cfg.Batch), staff...))
+	router.HandleFunc("GET /api/students/{id}", protected("students", student.GetById(storage), staff...))
+	router.HandleFunc("GET /api/students", protected("students", student.GetList(storage), staff...))
+	router.HandleFunc("DELETE /api/students/{id}", protected("students", student.DeleteStudent(storage), model.RoleAdmin))
+	router.HandleFunc("PUT /api/students/{id}", protected("students", student.UpdateStudent(storage), staff...))
+	router.HandleFunc("GET /api/students/search", protected("students", student.SearchStudent(storage), staff...))
 
 	//courses
-	router.HandleFunc("POST /api/courses", middleware.JWTMiddleware(course.New(storage)))
-	router.HandleFunc("POST /api/courses/batch", middleware.JWTMiddleware(course.NewBatch(storage)))
-	router.HandleFunc("GET /api/courses/{id}", middleware.JWTMiddleware(course.GetById(storage)))
-	router.HandleFunc("GET /api/courses", middleware.JWTMiddleware(course.GetAll(storage)))
-	router.HandleFunc("PUT /api/courses/{id}", middleware.JWTMiddleware(course.Update(storage)))
-	router.HandleFunc("DELETE /api/courses/{id}", middleware.JWTMiddleware(course.Delete(storage)))
-	router.HandleFunc("GET /api/courses/search", middleware.JWTMiddleware(course.Search(storage)))
+	router.HandleFunc("POST /api/courses", protected("courses", course.New(storage), staff...))
+	router.HandleFunc("POST /api/courses/batch", protected("courses", course.NewBatch(storage, cfg.Batch), staff...))
+	router.HandleFunc("GET /api/courses/{id}", protected("courses", course.GetById(storage), everyone...))
+	router.HandleFunc("GET /api/courses", protected("courses", course.GetAll(storage), everyone...))
+	router.HandleFunc("PUT /api/courses/{id}", protected("courses", course.Update(storage), staff...))
+	router.HandleFunc("DELETE /api/courses/{id}", protected("courses", course.Delete(storage), model.RoleAdmin))
+	router.HandleFunc("GET /api/courses/search", protected("courses", course.Search(storage), everyone...))
+	router.HandleFunc("GET /api/courses/{id}/prerequisites", protected("courses", course.GetPrerequisites(storage), everyone...))
+	router.HandleFunc("POST /api/courses/{id}/prerequisites", protected("courses", course.AddPrerequisite(storage), staff...))
+	router.HandleFunc("DELETE /api/courses/{id}/prerequisites/{prerequisite_id}", protected("courses", course.DeletePrerequisite(storage), staff...))
 
 	//student courses
-	router.HandleFunc("POST /api/students/{student_id}/enroll", middleware.JWTMiddleware(student_courses.EnrollStudent(storage)))
-	router.HandleFunc("GET /api/students/{student_id}/courses", middleware.JWTMiddleware(student_courses.GetStudentWithEnrolledCourse(storage)))
-
-	corsHandler := enableCORS(router)
+	router.HandleFunc("POST /api/students/{student_id}/enroll", protected("enrollments", student_courses.EnrollStudent(storage), staff...))
+	router.HandleFunc("GET /api/students/{student_id}/courses", protected("enrollments", student_courses.GetStudentWithEnrolledCourse(storage), staff...))
+	router.HandleFunc("DELETE /api/students/{student_id}/courses/{course_id}", protected("enrollments", student_courses.DropCourse(storage), staff...))
+	router.HandleFunc("POST /api/students/{student_id}/courses/drop", protected("enrollments", student_courses.DropCourses(storage), staff...))
+
+	//grades
+	router.HandleFunc("PUT /api/students/{student_id}/courses/{course_id}/grade", protected("grades", grade.RecordGrade(storage), staff...))
+	router.HandleFunc("GET /api/students/{student_id}/gpa", protected("grades", grade.GetGPA(storage), staff...))
+	router.HandleFunc("POST /api/students/{student_id}/transcripts", protected("grades", grade.IssueTranscript(storage), staff...))
+	router.HandleFunc("GET /api/students/{student_id}/transcripts", protected("grades", grade.ListTranscripts(storage), staff...))
+	router.HandleFunc("GET /api/students/{student_id}/transcripts/{hash}", protected("grades", grade.GetTranscript(storage), staff...))
+
+	//anyone holding a printed transcript can check it
+	router.HandleFunc("GET /api/transcripts/{hash}", limiter.Limit("public", grade.VerifyTranscript(storage)))
+
+	//attendance
+	router.HandleFunc("POST /api/courses/{id}/sessions", protected("attendance", attendance.CreateSession(storage), staff...))
+	router.HandleFunc("GET /api/courses/{id}/sessions", protected("attendance", attendance.GetSessions(storage), everyone...))
+	router.HandleFunc("DELETE /api/courses/{id}/sessions/{session_id}", protected("attendance", attendance.DeleteSession(storage), staff...))
+	router.HandleFunc("PUT /api/courses/{id}/sessions/{session_id}/attendance", protected("attendance", attendance.MarkAttendance(storage), staff...))
+	router.HandleFunc("GET /api/courses/{id}/sessions/{session_id}/attendance", protected("attendance", attendance.GetSessionAttendance(storage), staff...))
+	router.HandleFunc("GET /api/courses/{id}/attendance", protected("attendance", attendance.GetCourseAttendance(storage), staff...))
+	router.HandleFunc("GET /api/students/{student_id}/attendance", protected("attendance", attendance.GetStudentAttendance(storage), staff...))
+
+	//waitlists
+	router.HandleFunc("GET /api/courses/{id}/waitlist", protected("enrollments", student_courses.GetCourseWaitlist(storage), staff...))
+	router.HandleFunc("GET /api/students/{student_id}/waitlist", protected("enrollments", student_courses.GetStudentWaitlist(storage), staff...))
 
 	//setup server
 
+	//the requests still running when the shutdown timeout is over get their contexts cancelled
+	requests, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	proxies, err := cfg.Proxies()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	server := http.Server{
-		Addr:    cfg.Addr,
-		Handler: corsHandler,
+		Addr:              cfg.Addr,
+		Handler:           tracing.Middleware(middleware.RequestID(middleware.RealIP(proxies, middleware.Timeout(cfg.RequestTimeout, middleware.Logger(middleware.Metrics(metrics, middleware.Recover(middleware.CORS(cfg.CORS, tracing.Route(router))))))))),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return requests },
 	}
 
 	slog.Info("Server started", slog.String("address", cfg.Addr))
@@ -84,7 +238,7 @@ func main() {
 
 	go func() {
 		err := server.ListenAndServe()
-		if err != nil {
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("failed to start server %s", err)
 
 		}
@@ -94,34 +248,44 @@ func main() {
 
 	slog.Info("shutting down the server")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	//give the orchestrator time to see the failing readiness and stop routing traffic here
+	checker.Shutdown()
+	time.Sleep(cfg.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
 		slog.Error("failed to shutdown server", slog.String("error", err.Error()))
+		cancelRequests()
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("failed to flush traces", slog.String("error", err.Error()))
 	}
 
 	slog.Info("server shutdown successfully.")
 
 }
 
-// CORS middleware function
-func enableCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// newStorage opens the storage backend selected by storage_driver along with its database
+// handle and schema migrations
+func newStorage(cfg *config.Config) (storage.Storage, *sql.DB, *migrate.Migrator, error) {
+	switch cfg.StorageDriver {
+	case config.DriverPostgres:
+		store, err := postgres.New(cfg)
+		if err != nil {
+			return nil, nil, nil, err
 		}
-
-		// Call the next handler
-		next.ServeHTTP(w, r)
-	})
+		migrator, err := store.Migrator()
+		return store, store.Db, migrator, err
+	default:
+		store, err := sqlite.New(cfg)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		migrator, err := store.Migrator()
+		return store, store.Db, migrator, err
+	}
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/storage/migrate"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = "usage: students-api -config <file> migrate up | down | status | to <version>"
+
+// runMigrate handles the migrate subcommand
+func runMigrate(ctx context.Context, migrator *migrate.Migrator, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx)
+		printMigrations("applied", done)
+		return err
+
+	case "down":
+		done, err := migrator.Down(ctx)
+		printMigrations("rolled back", done)
+		return err
+
+	case "to":
+		if len(args) != 2 {
+			return fmt.Errorf(migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %s", args[1])
+		}
+		current, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		done, err := migrator.To(ctx, version)
+		if version < current {
+			printMigrations("rolled back", done)
+		} else {
+			printMigrations("applied", done)
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf(migrateUsage)
+	}
+}
+
+func printMigrations(action string, migrations []migrate.Migration) {
+	if len(migrations) == 0 {
+		fmt.Println("nothing to do")
+		return
+	}
+
+	for _, migration := range migrations {
+		fmt.Printf("%s %d_%s\n", action, migration.Version, migration.Name)
+	}
+}
@@ -2,31 +2,222 @@ package config
 
 import (
 	"flag"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/grading"
 	"log"
+	"net/netip"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type HTTPServer struct {
-	Addr string `yaml:"address" env-required:"true"`
+	Addr              string        `yaml:"address" env-required:"true"`
+	ShutdownDelay     time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`                      // readiness fails this long before the server stops accepting requests
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" env-default:"5s"` // in flight requests get this long to finish, their contexts are cancelled after it
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" env-default:"5s"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT" env-default:"15s"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" env-default:"30s"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" env-default:"60s"`
+	RequestTimeout    time.Duration `yaml:"request_timeout" env:"HTTP_REQUEST_TIMEOUT" env-default:"20s"` // the request context is cancelled after it, keep it below write_timeout
+	TrustedProxies    []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`                        // addresses or CIDRs of the proxies whose X-Forwarded-For is believed
 }
 
+// Proxies parses TrustedProxies, a single address is a prefix of its full length.
+func (s HTTPServer) Proxies() ([]netip.Prefix, error) {
+	proxies := make([]netip.Prefix, 0, len(s.TrustedProxies))
+	for _, entry := range s.TrustedProxies {
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %s", entry)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s", entry)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// JWT configures the tokens issued at sign in. Access tokens are short lived, refresh tokens
+// are stored server side and rotated on every use.
+type JWT struct {
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"JWT_ACCESS_TOKEN_TTL" env-default:"15m"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"JWT_REFRESH_TOKEN_TTL" env-default:"720h"`
+
+	//iss and aud of issued tokens, both are required on the tokens we accept
+	Issuer   string        `yaml:"issuer" env:"JWT_ISSUER" env-default:"students-api"`
+	Audience string        `yaml:"audience" env:"JWT_AUDIENCE" env-default:"students-api"`
+	Leeway   time.Duration `yaml:"leeway" env:"JWT_LEEWAY" env-default:"30s"` // allowed clock skew for exp, nbf and iat
+
+	//kid of the key new tokens are signed with, the other keys are only used to verify
+	//tokens signed before a rotation
+	SigningKey string   `yaml:"signing_key" env:"JWT_SIGNING_KEY"`
+	Keys       []JWTKey `yaml:"keys"`
+
+	//without keys in the file, an HS256 key with kid "default" is built from JWT_SECRET
+	Secret string `yaml:"-" env:"JWT_SECRET"`
+}
+
+// JWTKey is a signing or verification key. Key material is given inline or read from a
+// file; PEM keys may be PKCS#1 or PKCS#8 (RSA) and PKCS#8 / PKIX (Ed25519).
+type JWTKey struct {
+	Kid            string `yaml:"kid"`
+	Algorithm      string `yaml:"algorithm"` // HS256, RS256 or EdDSA
+	Secret         string `yaml:"secret"`
+	SecretFile     string `yaml:"secret_file"`
+	PrivateKey     string `yaml:"private_key"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKey      string `yaml:"public_key"` // verification only, when the private key is not available
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
+// Mailer configures outgoing email. The smtp driver delivers through Host, file writes .eml
+// files to Dir and log only logs the messages.
+type Mailer struct {
+	Driver   string `yaml:"driver" env:"MAILER_DRIVER" env-default:"log"`
+	From     string `yaml:"from" env:"MAILER_FROM" env-default:"no-reply@students-api.local"`
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     int    `yaml:"port" env:"SMTP_PORT" env-default:"587"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+	Dir      string `yaml:"dir" env:"MAILER_DIR" env-default:"storage/mail"`
+}
+
+// Accounts configures the password reset and email verification flows.
+type Accounts struct {
+	RequireEmailVerification bool          `yaml:"require_email_verification" env:"REQUIRE_EMAIL_VERIFICATION"` // sign in is refused until the email is verified
+	PasswordResetTTL         time.Duration `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL" env-default:"1h"`
+	EmailVerificationTTL     time.Duration `yaml:"email_verification_ttl" env:"EMAIL_VERIFICATION_TTL" env-default:"48h"`
+	LinkBaseURL              string        `yaml:"link_base_url" env:"ACCOUNT_LINK_BASE_URL" env-default:"http://localhost:3000"` // frontend pages the emailed links point to
+}
+
+// Batch configures the batch create endpoints.
+type Batch struct {
+	MaxSize  int   `yaml:"max_size" env:"BATCH_MAX_SIZE" env-default:"100"`       // larger batches are refused as a whole
+	MaxBytes int64 `yaml:"max_bytes" env:"BATCH_MAX_BYTES" env-default:"1048576"` // larger bodies are refused before they are decoded
+}
+
+// Login configures the throttling of failed sign in attempts, counted per account and per
+// client address. Every failure past the free attempts doubles the wait before the next
+// attempt up to max_delay, and reaching the lockout threshold locks the account or address
+// for lockout_duration.
+type Login struct {
+	FreeAttempts       int           `yaml:"free_attempts" env:"LOGIN_FREE_ATTEMPTS" env-default:"3"`
+	LockoutThreshold   int           `yaml:"lockout_threshold" env:"LOGIN_LOCKOUT_THRESHOLD" env-default:"10"`
+	IPFreeAttempts     int           `yaml:"ip_free_attempts" env:"LOGIN_IP_FREE_ATTEMPTS" env-default:"20"` // one address can be shared by many users
+	IPLockoutThreshold int           `yaml:"ip_lockout_threshold" env:"LOGIN_IP_LOCKOUT_THRESHOLD" env-default:"100"`
+	BaseDelay          time.Duration `yaml:"base_delay" env:"LOGIN_BASE_DELAY" env-default:"1s"`
+	MaxDelay           time.Duration `yaml:"max_delay" env:"LOGIN_MAX_DELAY" env-default:"5m"`
+	LockoutDuration    time.Duration `yaml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION" env-default:"30m"`
+	FailureWindow      time.Duration `yaml:"failure_window" env:"LOGIN_FAILURE_WINDOW" env-default:"1h"` // failures older than this are forgotten
+}
+
+// RateLimit is a token bucket per client: up to Burst requests at once, refilled at Rate
+// requests per second.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate" env-default:"10"`
+	Burst int     `yaml:"burst" env-default:"20"`
+}
+
+// RateLimits configures the request rate limiting. Clients are the user of a valid access
+// token and the client address otherwise. Every route group has its own
+// buckets, groups without an entry use the default limit.
+type RateLimits struct {
+	Enabled bool                 `yaml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	Default RateLimit            `yaml:"default"`
+	Groups  map[string]RateLimit `yaml:"groups"`
+}
+
+// CORS configures which browser origins may call the API. An origin is either exact
+// ("https://app.example.com"), a wildcard subdomain ("https://*.example.com") or "*", which
+// can not be combined with AllowCredentials.
+type CORS struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" env-default:"http://localhost:3000"`
+	AllowedMethods   []string      `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS" env-default:"GET,POST,PUT,DELETE"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS" env-default:"Content-Type,Authorization"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS" env-default:"Retry-After,RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,X-Transcript-Hash"`
+	MaxAge           time.Duration `yaml:"max_age" env:"CORS_MAX_AGE" env-default:"10m"` // how long browsers may cache a preflight
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+}
+
+// Validate checks the allowed origins. "*" is refused together with credentials, any origin
+// could read the responses of the signed in users.
+func (c CORS) Validate() error {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" && c.AllowCredentials {
+			return fmt.Errorf("allowed_origins can not contain * when allow_credentials is true, list the origins instead")
+		}
+		if origin == "*" || !strings.Contains(origin, "*") {
+			continue
+		}
+		if strings.Count(origin, "*") > 1 || !strings.Contains(origin, "://*.") {
+			return fmt.Errorf("invalid origin %s, wildcards are only allowed as the first label of the host", origin)
+		}
+	}
+
+	return nil
+}
+
+// Log configures the process logger. Level is debug, info, warn or error and format is
+// text or json.
+type Log struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL" env-default:"info"`
+	Format string `yaml:"format" env:"LOG_FORMAT" env-default:"text"`
+}
+
+// Tracing configures the OpenTelemetry traces. Exporter is none, stdout, file or otlp; the
+// otlp exporter sends to Endpoint over HTTP.
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_OTLP_ENDPOINT" env-default:"localhost:4318"`
+	Insecure    bool    `yaml:"insecure" env:"TRACING_OTLP_INSECURE"` // plain http to the collector
+	File        string  `yaml:"file" env:"TRACING_FILE" env-default:"storage/traces.jsonl"`
+	ServiceName string  `yaml:"service_name" env:"TRACING_SERVICE_NAME" env-default:"students-api"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" env-default:"1"` // share of new traces that are recorded
+}
+
+const (
+	DriverSqlite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
 // env-default:"production
 type Config struct {
-	Env         string `yaml:"env" env:"ENV" env-required:"true"`
-	StoragePath string `yaml:"storage_path" env-required:"true"`
-	HTTPServer  `yaml:"http_server"`
+	Env           string `yaml:"env" env:"ENV" env-required:"true"`
+	Log           Log    `yaml:"log"`
+	StorageDriver string `yaml:"storage_driver" env:"STORAGE_DRIVER" env-default:"sqlite"`
+	StoragePath   string `yaml:"storage_path"`                    // sqlite database file
+	DatabaseURL   string `yaml:"database_url" env:"DATABASE_URL"` // postgres connection string
+	HTTPServer    `yaml:"http_server"`
+	GradeScale    grading.Scale `yaml:"grade_scale"` // best to worst, defaults to grading.DefaultScale
+	JWT           JWT           `yaml:"jwt"`
+	Mailer        Mailer        `yaml:"mailer"`
+	Accounts      Accounts      `yaml:"accounts"`
+	Batch         Batch         `yaml:"batch"`
+	Login         Login         `yaml:"login"`
+	RateLimits    RateLimits    `yaml:"rate_limits"`
+	CORS          CORS          `yaml:"cors"`
+	Tracing       Tracing       `yaml:"tracing"`
 }
 
 func MustLoad() *Config {
 	var configPath string
 	configPath = os.Getenv("CONFIG_PATH")
 
-	if configPath == "" {
-		flags := flag.String("config", "", "path to the configuration file")
-		flag.Parse()
+	//flags are always parsed so the remaining arguments (e.g. the migrate command) are available through flag.Args()
+	flags := flag.String("config", "", "path to the configuration file")
+	flag.Parse()
 
+	if configPath == "" {
 		configPath = *flags
 
 		if configPath == "" {
@@ -47,6 +238,86 @@ func MustLoad() *Config {
 
 	}
 
+	if len(cfg.GradeScale) == 0 {
+		cfg.GradeScale = grading.DefaultScale
+	}
+
+	if err := cfg.GradeScale.Validate(); err != nil {
+		log.Fatalf("invalid grade_scale: %s", err.Error())
+	}
+
+	if cfg.JWT.AccessTokenTTL <= 0 || cfg.JWT.RefreshTokenTTL <= 0 {
+		log.Fatal("jwt token ttls must be positive")
+	}
+
+	server := cfg.HTTPServer
+	if server.ShutdownTimeout <= 0 || server.ReadHeaderTimeout <= 0 || server.ReadTimeout <= 0 || server.WriteTimeout <= 0 || server.IdleTimeout <= 0 || server.RequestTimeout <= 0 {
+		log.Fatal("http_server timeouts must be positive")
+	}
+
+	if server.RequestTimeout >= server.WriteTimeout {
+		log.Fatal("http_server request_timeout must be below write_timeout")
+	}
+
+	if _, err := server.Proxies(); err != nil {
+		log.Fatalf("http_server trusted_proxies: %s", err.Error())
+	}
+
+	if cfg.Batch.MaxSize < 1 {
+		log.Fatal("batch max_size must be at least 1")
+	}
+
+	if cfg.Batch.MaxBytes < 1 {
+		log.Fatal("batch max_bytes must be at least 1")
+	}
+
+	if cfg.Login.FreeAttempts >= cfg.Login.LockoutThreshold || cfg.Login.IPFreeAttempts >= cfg.Login.IPLockoutThreshold {
+		log.Fatal("login lockout thresholds must be above the free attempts")
+	}
+
+	if cfg.Login.BaseDelay <= 0 || cfg.Login.MaxDelay < cfg.Login.BaseDelay || cfg.Login.LockoutDuration <= 0 {
+		log.Fatal("login delays must be positive and max_delay at least base_delay")
+	}
+
+	if cfg.RateLimits.Default.Rate <= 0 || cfg.RateLimits.Default.Burst < 1 {
+		log.Fatal("default rate limit needs a positive rate and burst")
+	}
+
+	for group, limit := range cfg.RateLimits.Groups {
+		if limit.Rate <= 0 || limit.Burst < 1 {
+			log.Fatalf("rate limit of group %s needs a positive rate and burst", group)
+		}
+	}
+
+	if err := cfg.CORS.Validate(); err != nil {
+		log.Fatalf("cors: %s", err.Error())
+	}
+
+	if len(cfg.JWT.Keys) == 0 && cfg.JWT.Secret != "" {
+		cfg.JWT.Keys = []JWTKey{{Kid: "default", Algorithm: "HS256", Secret: cfg.JWT.Secret}}
+	}
+
+	if len(cfg.JWT.Keys) == 0 {
+		log.Fatal("no jwt keys configured, set jwt.keys or JWT_SECRET")
+	}
+
+	if cfg.JWT.SigningKey == "" {
+		cfg.JWT.SigningKey = cfg.JWT.Keys[0].Kid
+	}
+
+	switch cfg.StorageDriver {
+	case DriverSqlite:
+		if cfg.StoragePath == "" {
+			log.Fatal("storage_path is required for the sqlite storage driver")
+		}
+	case DriverPostgres:
+		if cfg.DatabaseURL == "" {
+			log.Fatal("database_url is required for the postgres storage driver")
+		}
+	default:
+		log.Fatalf("unknown storage driver: %s", cfg.StorageDriver)
+	}
+
 	return &cfg
 
 }
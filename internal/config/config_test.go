@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestCORSValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		valid       bool
+	}{
+		{"exact origins with credentials", []string{"https://app.example.com", "http://localhost:3000"}, true, true},
+		{"any origin", []string{"*"}, false, true},
+		{"any origin with credentials", []string{"*"}, true, false},
+		{"any origin next to a listed one with credentials", []string{"https://app.example.com", "*"}, true, false},
+		{"wildcard subdomain with credentials", []string{"https://*.example.com"}, true, true},
+		{"wildcard in a later label", []string{"https://app.*.com"}, false, false},
+		{"wildcard without a scheme", []string{"*.example.com"}, false, false},
+		{"two wildcards", []string{"https://*.*.example.com"}, false, false},
+		{"partial label", []string{"https://app*.example.com"}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CORS{AllowedOrigins: tt.origins, AllowCredentials: tt.credentials}.Validate()
+			if (err == nil) != tt.valid {
+				t.Errorf("got %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package grading
+
+import (
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"math"
+	"strings"
+)
+
+// Grade is one step of a grade-point scale.
+type Grade struct {
+	Letter   string  `yaml:"letter" json:"letter"`
+	Points   float64 `yaml:"points" json:"points"`
+	MinScore float64 `yaml:"min_score" json:"min_score"` // lowest numeric score (0-100) that earns this letter
+}
+
+// Scale lists the letter grades from best to worst.
+type Scale []Grade
+
+var DefaultScale = Scale{
+	{Letter: "A", Points: 4.0, MinScore: 93},
+	{Letter: "A-", Points: 3.7, MinScore: 90},
+	{Letter: "B+", Points: 3.3, MinScore: 87},
+	{Letter: "B", Points: 3.0, MinScore: 83},
+	{Letter: "B-", Points: 2.7, MinScore: 80},
+	{Letter: "C+", Points: 2.3, MinScore: 77},
+	{Letter: "C", Points: 2.0, MinScore: 73},
+	{Letter: "C-", Points: 1.7, MinScore: 70},
+	{Letter: "D+", Points: 1.3, MinScore: 67},
+	{Letter: "D", Points: 1.0, MinScore: 63},
+	{Letter: "D-", Points: 0.7, MinScore: 60},
+	{Letter: "F", Points: 0.0, MinScore: 0},
+}
+
+// Validate checks that the scale is ordered from best to worst and that every score maps to a letter.
+func (s Scale) Validate() error {
+	if len(s) == 0 {
+		return fmt.Errorf("grade scale is empty")
+	}
+
+	seen := map[string]bool{}
+	for i, grade := range s {
+		letter := strings.ToUpper(strings.TrimSpace(grade.Letter))
+		if letter == "" {
+			return fmt.Errorf("grade %d has no letter", i+1)
+		}
+		if seen[letter] {
+			return fmt.Errorf("grade %s is listed twice", grade.Letter)
+		}
+		seen[letter] = true
+
+		if i > 0 && (grade.Points > s[i-1].Points || grade.MinScore > s[i-1].MinScore) {
+			return fmt.Errorf("grades must be listed from best to worst, %s is out of order", grade.Letter)
+		}
+	}
+
+	if s[len(s)-1].MinScore != 0 {
+		return fmt.Errorf("the lowest grade must have a min_score of 0")
+	}
+
+	return nil
+}
+
+// ForScore returns the letter grade earned with a numeric score.
+func (s Scale) ForScore(score float64) (Grade, bool) {
+	for _, grade := range s {
+		if score >= grade.MinScore {
+			return grade, true
+		}
+	}
+	return Grade{}, false
+}
+
+// Find looks a letter grade up, ignoring case.
+func (s Scale) Find(letter string) (Grade, bool) {
+	i := s.rank(letter)
+	if i < 0 {
+		return Grade{}, false
+	}
+	return s[i], true
+}
+
+// Meets reports whether letter is at least as good as minimum. An empty minimum is met by
+// any passing grade, one worth more than 0 points, an unknown letter meets nothing.
+func (s Scale) Meets(letter string, minimum string) bool {
+	if minimum == "" {
+		grade, ok := s.Find(letter)
+		return ok && grade.Points > 0
+	}
+
+	have, want := s.rank(letter), s.rank(minimum)
+	return have >= 0 && want >= 0 && have <= want
+}
+
+func (s Scale) rank(letter string) int {
+	for i, grade := range s {
+		if strings.EqualFold(grade.Letter, strings.TrimSpace(letter)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Report computes the cumulative and per term GPA of a student, weighting each grade by the
+// credits of its course. Terms are listed in the order they first appear in grades.
+func Report(studentId int64, grades []model.CourseGrade) model.GPAReport {
+	report := model.GPAReport{StudentId: studentId, Courses: grades}
+
+	type term struct {
+		academicYear string
+		semester     string
+		credits      int
+		points       float64
+	}
+
+	var order []string
+	terms := map[string]*term{}
+	var totalPoints float64
+
+	for _, grade := range grades {
+		key := grade.AcademicYear + "/" + grade.Semester
+		t, ok := terms[key]
+		if !ok {
+			t = &term{academicYear: grade.AcademicYear, semester: grade.Semester}
+			terms[key] = t
+			order = append(order, key)
+		}
+
+		points := grade.GradePoints * float64(grade.Credits)
+		t.credits += grade.Credits
+		t.points += points
+
+		report.TotalCredits += grade.Credits
+		totalPoints += points
+	}
+
+	for _, key := range order {
+		t := terms[key]
+		report.Terms = append(report.Terms, model.TermGPA{
+			AcademicYear: t.academicYear,
+			Semester:     t.semester,
+			Credits:      t.credits,
+			GPA:          gpa(t.points, t.credits),
+		})
+	}
+
+	report.CumulativeGPA = gpa(totalPoints, report.TotalCredits)
+
+	return report
+}
+
+func gpa(points float64, credits int) float64 {
+	if credits == 0 {
+		return 0
+	}
+	return math.Round(points/float64(credits)*100) / 100
+}
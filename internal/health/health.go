@@ -0,0 +1,132 @@
+package health
+
+import (
+	"context"
+	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// every readiness check has to answer within this time
+const checkTimeout = 2 * time.Second
+
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusShutdown = "shutting_down"
+)
+
+// Check is a dependency the service needs to serve requests.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Checker answers the liveness and readiness probes.
+type Checker struct {
+	checks       []Check
+	shuttingDown atomic.Bool
+}
+
+func New(checks ...Check) *Checker {
+	return &Checker{checks: checks}
+}
+
+// Shutdown makes the readiness probe fail from now on, so no new traffic is routed here
+// while the server drains.
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Live reports that the process is up and able to answer HTTP requests.
+func (c *Checker) Live() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("alive", http.StatusOK, map[string]string{"status": StatusOK}))
+	}
+}
+
+// Ready runs every check concurrently and answers 503 when one of them fails or the
+// server is shutting down.
+func (c *Checker) Ready() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		report := c.run(r.Context())
+
+		if report.Status != StatusOK {
+			response.WriteJson(w, http.StatusServiceUnavailable, response.Response{
+				Status:  http.StatusServiceUnavailable,
+				Success: false,
+				Message: "not ready",
+				Data:    report,
+			})
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("ready", http.StatusOK, report))
+	}
+}
+
+func (c *Checker) run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(c.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check.Run(ctx)
+
+			result := CheckResult{Status: StatusOK, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				result.Status = StatusFailing
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			if err != nil {
+				report.Status = StatusFailing
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if c.shuttingDown.Load() {
+		report.Status = StatusShutdown
+	}
+
+	return report
+}
+
+// Ping checks a dependency that can be pinged, like *sql.DB.
+func Ping(name string, pinger interface{ PingContext(context.Context) error }) Check {
+	return Check{Name: name, Run: pinger.PingContext}
+}
+
+// Func names a check function, like the Check method of the schema migrator. The function
+// has to return once ctx is done.
+func Func(name string, check func(ctx context.Context) error) Check {
+	return Check{Name: name, Run: check}
+}
@@ -0,0 +1,252 @@
+package attendance
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/utils"
+	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func CreateSession(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		courseId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid ID format. Please enter a valid number"), http.StatusBadRequest))
+			return
+		}
+
+		var session model.CourseSession
+		err = json.NewDecoder(r.Body).Decode(&session)
+		if errors.Is(err, io.EOF) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("empty body"), http.StatusBadRequest))
+			return
+		}
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+			return
+		}
+
+		if err := validator.New().Struct(session); err != nil {
+			var validation validator.ValidationErrors
+			errors.As(err, &validation)
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validation, http.StatusBadRequest))
+			return
+		}
+
+		//both are HH:MM, so they compare as strings
+		if session.EndTime <= session.StartTime {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("end_time must be after start_time"), http.StatusBadRequest))
+			return
+		}
+
+		created, err := storage.CreateCourseSession(r.Context(), courseId, session)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("course not found"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusCreated, response.GeneralResponse("session created successfully", http.StatusCreated, created))
+
+	}
+}
+
+func GetSessions(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		courseId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid ID format. Please enter a valid number"), http.StatusBadRequest))
+			return
+		}
+
+		sessions, err := storage.GetCourseSessions(r.Context(), courseId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("course not found"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, sessions))
+
+	}
+}
+
+func DeleteSession(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		courseId, sessionId, ok := sessionPath(w, r)
+		if !ok {
+			return
+		}
+
+		err := storage.DeleteCourseSession(r.Context(), courseId, sessionId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("session %d not found in course %d", sessionId, courseId), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("session deleted successfully", http.StatusOK, map[string]int64{"id": sessionId}))
+
+	}
+}
+
+// MarkAttendance records the attendance of a session, either per student or for the
+// whole session at once. Students that are not enrolled are reported, not marked.
+func MarkAttendance(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		courseId, sessionId, ok := sessionPath(w, r)
+		if !ok {
+			return
+		}
+
+		var req model.AttendanceRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if errors.Is(err, io.EOF) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("empty body"), http.StatusBadRequest))
+			return
+		}
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			var validation validator.ValidationErrors
+			errors.As(err, &validation)
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validation, http.StatusBadRequest))
+			return
+		}
+
+		if req.Status == "" && len(req.Records) == 0 {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("status or records are required"), http.StatusBadRequest))
+			return
+		}
+
+		principal, _ := utils.PrincipalFromContext(r.Context())
+
+		result, err := storage.MarkAttendance(r.Context(), courseId, sessionId, req, principal.UserID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("session %d not found in course %d", sessionId, courseId), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("attendance recorded", http.StatusOK, result))
+
+	}
+}
+
+func GetSessionAttendance(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		courseId, sessionId, ok := sessionPath(w, r)
+		if !ok {
+			return
+		}
+
+		records, err := storage.GetSessionAttendance(r.Context(), courseId, sessionId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("session %d not found in course %d", sessionId, courseId), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, records))
+
+	}
+}
+
+func GetCourseAttendance(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		courseId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid ID format. Please enter a valid number"), http.StatusBadRequest))
+			return
+		}
+
+		summaries, err := storage.GetCourseAttendance(r.Context(), courseId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("course not found"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, summaries))
+
+	}
+}
+
+func GetStudentAttendance(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		studentId, err := strconv.ParseInt(r.PathValue("student_id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid student id"), http.StatusBadRequest))
+			return
+		}
+
+		summaries, err := storage.GetStudentAttendance(r.Context(), studentId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("student not found"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, summaries))
+
+	}
+}
+
+// sessionPath parses the course and session ids of the request path, writing the error
+// response itself when one of them is invalid.
+func sessionPath(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+
+	courseId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid ID format. Please enter a valid number"), http.StatusBadRequest))
+		return 0, 0, false
+	}
+
+	sessionId, err := strconv.ParseInt(r.PathValue("session_id"), 10, 64)
+	if err != nil {
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid session id"), http.StatusBadRequest))
+		return 0, 0, false
+	}
+
+	return courseId, sessionId, true
+}
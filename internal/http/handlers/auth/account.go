@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/mailer"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ForgotPassword emails a password reset link. The lookup and the email happen after the
+// response, which is the same 202 whether or not the email belongs to an account, so neither
+// the status nor the response time tell which emails exist.
+func ForgotPassword(storage storage.Storage, mail mailer.Mailer, cfg config.Accounts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var req model.EmailRequest
+		if !decodeValid(w, r, &req) {
+			return
+		}
+
+		//the request context ends with the response, the email is sent without its deadline
+		ctx := context.WithoutCancel(r.Context())
+		go sendPasswordReset(ctx, storage, mail, cfg, req.Email)
+
+		response.WriteJson(w, http.StatusAccepted, response.GeneralResponse("if an account exists for this email, a reset link has been sent", http.StatusAccepted, nil))
+	}
+}
+
+// sendPasswordReset emails a reset link to the account of email, if there is one. Failures
+// can not be reported to the caller anymore and are logged.
+func sendPasswordReset(ctx context.Context, storage storage.Storage, mail mailer.Mailer, cfg config.Accounts, email string) {
+	ctx, cancel := context.WithTimeout(ctx, passwordResetTimeout)
+	defer cancel()
+
+	user, err := storage.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		slog.Error("password reset lookup failed", slog.String("error", err.Error()))
+		return
+	}
+
+	err = sendAccountEmail(ctx, storage, mail, user, model.AccountTokenPasswordReset, cfg.PasswordResetTTL,
+		"Reset your password", cfg.LinkBaseURL+"/reset-password")
+	if err != nil {
+		slog.Error("password reset email failed", slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+	}
+}
+
+// passwordResetTimeout bounds the lookup and email of a reset request running after its response.
+const passwordResetTimeout = 30 * time.Second
+
+// ResetPassword sets a new password with the token of a reset email and signs the user out
+// of every session.
+func ResetPassword(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var req model.PasswordResetRequest
+		if !decodeValid(w, r, &req) {
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(fmt.Errorf("something went wrong"), http.StatusInternalServerError))
+			return
+		}
+
+		userId, err := storage.ResetPassword(r.Context(), hashToken(req.Token), string(hashedPassword))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid or expired reset token"), http.StatusBadRequest))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		if err := storage.RevokeUserSessions(r.Context(), userId); err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("password has been reset, please sign in again", http.StatusOK, nil))
+	}
+}
+
+func VerifyEmail(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var req model.TokenRequest
+		if !decodeValid(w, r, &req) {
+			return
+		}
+
+		_, err := storage.VerifyEmail(r.Context(), hashToken(req.Token))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid or expired verification token"), http.StatusBadRequest))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("email verified", http.StatusOK, nil))
+	}
+}
+
+// ResendVerification emails a new verification link, answering the same way for unknown
+// and already verified emails.
+func ResendVerification(storage storage.Storage, mail mailer.Mailer, cfg config.Accounts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var req model.EmailRequest
+		if !decodeValid(w, r, &req) {
+			return
+		}
+
+		user, err := storage.GetUserByEmail(r.Context(), req.Email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		if user != nil && user.EmailVerifiedAt == nil {
+			if err := sendVerificationEmail(r.Context(), storage, mail, user, cfg); err != nil {
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(fmt.Errorf("could not send the verification email"), http.StatusInternalServerError))
+				return
+			}
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("if an unverified account exists for this email, a verification link has been sent", http.StatusOK, nil))
+	}
+}
+
+// sendSignupVerification emails the verification link of an account that just signed up.
+// The account exists either way, a lost email can be sent again.
+func sendSignupVerification(ctx context.Context, storage storage.Storage, mail mailer.Mailer, cfg config.Accounts, user model.User) {
+	ctx, cancel := context.WithTimeout(ctx, signupEmailTimeout)
+	defer cancel()
+
+	_ = sendVerificationEmail(ctx, storage, mail, &user, cfg)
+}
+
+// sendSignupAttempt tells the owner of an account that someone tried to sign up with its
+// email, instead of telling the one who tried.
+func sendSignupAttempt(ctx context.Context, storage storage.Storage, mail mailer.Mailer, cfg config.Accounts, email string) {
+	ctx, cancel := context.WithTimeout(ctx, signupEmailTimeout)
+	defer cancel()
+
+	user, err := storage.GetUserByEmail(ctx, email)
+	if err != nil {
+		slog.Error("signup attempt lookup failed", slog.String("error", err.Error()))
+		return
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hello %s,\n\n", user.Name)
+	fmt.Fprintf(&body, "Someone tried to sign up with this email, which already has an account.\n\n")
+	fmt.Fprintf(&body, "If it was you, sign in instead or reset your password at %s/forgot-password\n\n", cfg.LinkBaseURL)
+	fmt.Fprintf(&body, "If it was not you, you can ignore this email, your account did not change.\n")
+
+	err = mail.Send(ctx, mailer.Message{To: user.Email, Subject: "Someone tried to sign up with your email", Body: body.String()})
+	if err != nil {
+		slog.Error("signup attempt email failed", slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+	}
+}
+
+// signupEmailTimeout bounds the email of a signup sent after its response.
+const signupEmailTimeout = 30 * time.Second
+
+func sendVerificationEmail(ctx context.Context, storage storage.Storage, mail mailer.Mailer, user *model.User, cfg config.Accounts) error {
+	return sendAccountEmail(ctx, storage, mail, user, model.AccountTokenEmailVerification, cfg.EmailVerificationTTL,
+		"Verify your email", cfg.LinkBaseURL+"/verify-email")
+}
+
+// sendAccountEmail creates a single use token for the user and emails it as a link to page.
+func sendAccountEmail(ctx context.Context, storage storage.Storage, mail mailer.Mailer, user *model.User, purpose string, ttl time.Duration, subject string, page string) error {
+
+	raw, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	err = storage.CreateAccountToken(ctx, model.AccountToken{
+		UserId:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashToken(raw),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hello %s,\n\n", user.Name)
+	fmt.Fprintf(&body, "Open the link below to continue. It can be used once and expires in %s.\n\n", ttl)
+	fmt.Fprintf(&body, "%s?token=%s\n\n", page, url.QueryEscape(raw))
+	fmt.Fprintf(&body, "If you did not ask for this email, you can ignore it.\n")
+
+	err = mail.Send(ctx, mailer.Message{To: user.Email, Subject: subject, Body: body.String()})
+	if err != nil {
+		slog.Error("sending account email failed", slog.String("purpose", purpose), slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+	}
+
+	return err
+}
+
+// decodeValid decodes and validates the JSON body into req, writing the error response
+// itself when that fails.
+func decodeValid(w http.ResponseWriter, r *http.Request, req any) bool {
+
+	err := json.NewDecoder(r.Body).Decode(req)
+	if errors.Is(err, io.EOF) {
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("empty body"), http.StatusBadRequest))
+		return false
+	}
+	if err != nil {
+		response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+		return false
+	}
+
+	if err := validator.New().Struct(req); err != nil {
+		var validation validator.ValidationErrors
+		errors.As(err, &validation)
+		response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validation, http.StatusBadRequest))
+		return false
+	}
+
+	return true
+}
@@ -1,11 +1,17 @@
 package auth
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/lockout"
+	"github/com/ammar-nousher-ali/students-api/internal/mailer"
 	"github/com/ammar-nousher-ali/students-api/internal/model"
 	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/token"
 	"github/com/ammar-nousher-ali/students-api/internal/utils"
 	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
 	"io"
@@ -14,20 +20,17 @@ import (
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var JwtSecret = []byte("mydevtestingkey123456789")
-
 type SignUpRequest struct {
 	Name     string `json:"name" validate:"required"`
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"reqyured,min=6"`
-	Role     string `json:"role" validate:"required,oneof=student teacher"`
+	Password string `json:"password" validate:"required,min=6"`
+	Role     string `json:"role" validate:"omitempty,oneof=student"` // teachers are promoted by an admin, see SetRole
 }
 
-func Signup(storage storage.Storage) http.HandlerFunc {
+func Signup(storage storage.Storage, mail mailer.Mailer, accounts config.Accounts) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		var req SignUpRequest
@@ -39,23 +42,18 @@ func Signup(storage storage.Storage) http.HandlerFunc {
 		}
 
 		req.Role = strings.ToLower(req.Role)
-		exists, err := storage.IsEmailTaken(req.Email)
-		if err != nil {
-			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
-			return
+		if req.Role == "" {
+			req.Role = model.RoleStudent
 		}
 
-		if exists {
-			response.WriteJson(w, http.StatusConflict,
-				response.GeneralError(
-					fmt.Errorf("user with email %s already exists. please try again with different email", req.Email),
-					http.StatusConflict),
-			)
-
+		if err := validator.New().Struct(req); err != nil {
+			var validateErrs validator.ValidationErrors
+			errors.As(err, &validateErrs)
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validateErrs, http.StatusBadRequest))
 			return
 		}
 
-		//hash password
+		//the password is hashed before the lookup, so a taken email answers as slowly as a new one
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(
@@ -66,6 +64,12 @@ func Signup(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
+		exists, err := storage.IsEmailTaken(r.Context(), req.Email)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
 		user := model.User{
 			Name:     req.Name,
 			Email:    req.Email,
@@ -73,38 +77,42 @@ func Signup(storage storage.Storage) http.HandlerFunc {
 			Role:     req.Role,
 		}
 
-		userID, err := storage.CreateUser(user)
-		if err != nil {
-			response.WriteJson(w, http.StatusInternalServerError,
-				response.GeneralResponse(
-					"error while creating user",
-					http.StatusInternalServerError,
-					response.GeneralError(err,
-						http.StatusInternalServerError),
-				),
-			)
-			return
+		if !exists {
+			user.ID, err = storage.CreateUser(r.Context(), user)
+			//an account created since the lookup is answered like any taken email
+			exists = errors.Is(err, model.ErrDuplicate)
+			if err != nil && !exists {
+				response.WriteJson(w, http.StatusInternalServerError,
+					response.GeneralResponse(
+						"error while creating user",
+						http.StatusInternalServerError,
+						response.GeneralError(err,
+							http.StatusInternalServerError),
+					),
+				)
+				return
+			}
 		}
 
-		user.ID = userID
-		user.Password = ""
+		//the emails go out after the response, which does not tell whether the email was taken
+		ctx := context.WithoutCancel(r.Context())
+		if exists {
+			go sendSignupAttempt(ctx, storage, mail, accounts, req.Email)
+		} else {
+			go sendSignupVerification(ctx, storage, mail, accounts, user)
+		}
 
-		response.WriteJson(w, http.StatusCreated,
+		response.WriteJson(w, http.StatusAccepted,
 			response.GeneralResponse(
-				"user created successfully",
-				http.StatusCreated,
-				map[string]any{
-					"id":    user.ID,
-					"name":  user.Name,
-					"email": user.Email,
-					"role":  user.Role,
-				},
+				"check your email to finish signing up",
+				http.StatusAccepted,
+				nil,
 			),
 		)
 	}
 }
 
-func SignIn(storage storage.Storage) http.HandlerFunc {
+func SignIn(storage storage.Storage, cfg config.JWT, keys *token.KeySet, accounts config.Accounts, guard *lockout.Guard) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		var creds model.Creds
@@ -128,41 +136,223 @@ func SignIn(storage storage.Storage) http.HandlerFunc {
 
 		}
 
-		user, err := storage.GetUserByEmail(creds.Email)
+		ip := utils.ClientIP(r)
+		now := time.Now()
+
+		release, wait, err := guard.Begin(r.Context(), creds.Email, ip, now)
 		if err != nil {
-			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(err, http.StatusUnauthorized))
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
 			return
 		}
-		if !utils.CheckPasswordHash(creds.Password, user.Password) {
-			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("invalid password"), http.StatusUnauthorized))
+
+		if wait > 0 {
+			tooManyAttempts(w, wait)
 			return
 		}
 
-		expires := time.Now().Add(24 * time.Hour).Unix()
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"user_id": user.ID,
-			"email":   user.Email,
-			"role":    user.Role,
-			"expires": expires,
-		})
+		defer release()
+
+		//unknown emails and wrong passwords get the same answer in about the same time, so
+		//the response does not tell which emails have an account
+		user, err := storage.GetUserByEmail(r.Context(), creds.Email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		found := err == nil
+
+		hash := dummyHash()
+		if found {
+			hash = user.Password
+		}
+
+		if !utils.CheckPasswordHash(creds.Password, hash) || !found {
+			if err := guard.Fail(r.Context(), creds.Email, ip, now); err != nil {
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+				return
+			}
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("invalid email or password"), http.StatusUnauthorized))
+			return
+		}
+
+		if err := guard.Succeed(r.Context(), creds.Email); err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
 
-		tokenString, err := token.SignedString(JwtSecret)
+		if accounts.RequireEmailVerification && user.EmailVerifiedAt == nil {
+			response.WriteJson(w, http.StatusForbidden, response.CodedError(fmt.Errorf("please verify your email before signing in"), http.StatusForbidden, model.AuthErrEmailNotVerified))
+			return
+		}
+
+		familyId, err := randomToken(16)
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
 			return
 		}
 
+		tokens, refreshToken, err := issueTokens(user, familyId, cfg, keys)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		if err := storage.CreateRefreshToken(r.Context(), refreshToken); err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
 		response.WriteJson(
 			w,
 			http.StatusOK,
 			response.GeneralResponse(
 				"login successfull",
 				http.StatusOK,
-				map[string]any{
-					"token":      tokenString,
-					"expires_in": expires,
-				},
+				tokens,
 			),
 		)
 	}
 }
+
+// Refresh exchanges a refresh token for a new access and refresh token. A refresh token
+// can only be used once, presenting it again revokes the whole session since either the
+// client or an attacker holds a stolen copy.
+func Refresh(storage storage.Storage, cfg config.JWT, keys *token.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var req model.RefreshRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if errors.Is(err, io.EOF) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("empty body"), http.StatusBadRequest))
+			return
+		}
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			var validation validator.ValidationErrors
+			errors.As(err, &validation)
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validation, http.StatusBadRequest))
+			return
+		}
+
+		current, err := storage.GetRefreshToken(r.Context(), hashToken(req.RefreshToken))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("invalid refresh token"), http.StatusUnauthorized))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		if current.UsedAt != nil || current.RevokedAt != nil {
+			revokeReused(w, r, storage, current.FamilyId)
+			return
+		}
+
+		if time.Now().After(current.ExpiresAt) {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("refresh token expired, please sign in again"), http.StatusUnauthorized))
+			return
+		}
+
+		//the role may have changed since the session started
+		user, err := storage.GetUserById(r.Context(), current.UserId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("invalid refresh token"), http.StatusUnauthorized))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		tokens, next, err := issueTokens(user, current.FamilyId, cfg, keys)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		err = storage.RotateRefreshToken(r.Context(), current.Id, next)
+		if err != nil {
+			if errors.Is(err, model.ErrTokenReused) {
+				revokeReused(w, r, storage, current.FamilyId)
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("token refreshed", http.StatusOK, tokens))
+	}
+}
+
+// SignOut revokes the access token of the request and the refresh tokens of its session.
+func SignOut(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		principal, ok := utils.PrincipalFromContext(r.Context())
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("authentication required"), http.StatusUnauthorized))
+			return
+		}
+
+		if err := storage.RevokeSession(r.Context(), principal.SessionID); err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		//the session may not know about this token when it was issued by an older rotation
+		if err := storage.RevokeAccessToken(r.Context(), principal.TokenID, principal.UserID, principal.ExpiresAt); err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("signed out", http.StatusOK, nil))
+	}
+}
+
+// SignOutAll revokes every session of the authenticated user.
+func SignOutAll(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		principal, ok := utils.PrincipalFromContext(r.Context())
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("authentication required"), http.StatusUnauthorized))
+			return
+		}
+
+		if err := storage.RevokeUserSessions(r.Context(), principal.UserID); err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		if err := storage.RevokeAccessToken(r.Context(), principal.TokenID, principal.UserID, principal.ExpiresAt); err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("signed out of all sessions", http.StatusOK, nil))
+	}
+}
+
+func revokeReused(w http.ResponseWriter, r *http.Request, storage storage.Storage, familyId string) {
+	if err := storage.RevokeSession(r.Context(), familyId); err != nil {
+		response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+		return
+	}
+
+	response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("refresh token was already used, the session has been revoked"), http.StatusUnauthorized))
+}
+
+// JWKS publishes the public verification keys so other services can check our tokens.
+func JWKS(keys *token.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		response.WriteJson(w, http.StatusOK, keys.JWKS())
+	}
+}
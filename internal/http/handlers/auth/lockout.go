@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/lockout"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against when the email is unknown, so the sign in takes as long as
+// with a wrong password.
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not the password of anyone"), bcrypt.DefaultCost)
+	return string(hash)
+})
+
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	response.WriteJson(w, http.StatusTooManyRequests, response.CodedError(fmt.Errorf("too many failed sign in attempts, try again later"), http.StatusTooManyRequests, model.AuthErrTooManyAttempts))
+}
+
+// Unlock clears the failed sign in attempts of a user so a locked out account can sign in
+// again right away.
+func Unlock(storage storage.Storage, guard *lockout.Guard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		userId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid user id"), http.StatusBadRequest))
+			return
+		}
+
+		user, err := storage.GetUserById(r.Context(), userId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no user found for this id"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		if err := guard.Unlock(r.Context(), user.Email); err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("account unlocked", http.StatusOK, map[string]int64{"id": user.ID}))
+
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+type SetRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=student teacher"` // admins are created with the create-admin command
+}
+
+// SetRole grants or takes back the teacher role. The existing sessions of the user are
+// revoked, their refresh tokens and the access tokens issued with them, so no token with the
+// old role is accepted anymore and the new role is picked up at the next sign in.
+func SetRole(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		userId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid user id"), http.StatusBadRequest))
+			return
+		}
+
+		var req SetRoleRequest
+		if !decodeValid(w, r, &req) {
+			return
+		}
+
+		user, err := storage.GetUserById(r.Context(), userId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no user found for this id"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		if user.Role == model.RoleAdmin {
+			response.WriteJson(w, http.StatusConflict, response.GeneralError(fmt.Errorf("the role of an admin can not be changed"), http.StatusConflict))
+			return
+		}
+
+		if user.Role != req.Role {
+			if err := storage.SetUserRole(r.Context(), user.ID, req.Role); err != nil {
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+				return
+			}
+
+			if err := storage.RevokeUserSessions(r.Context(), user.ID); err != nil {
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+				return
+			}
+
+			slog.InfoContext(r.Context(), "user role changed", slog.Int64("user_id", user.ID), slog.String("from", user.Role), slog.String("to", req.Role))
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("role updated", http.StatusOK, map[string]any{"id": user.ID, "role": req.Role}))
+
+	}
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/token"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// issueTokens signs a new access token for the user and creates the refresh token that goes
+// with it. familyId is the sign in session both tokens belong to. The returned record has
+// to be stored before the tokens are handed out.
+func issueTokens(user *model.User, familyId string, cfg config.JWT, keys *token.KeySet) (map[string]any, model.RefreshToken, error) {
+
+	now := time.Now().UTC()
+
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, model.RefreshToken{}, err
+	}
+
+	accessExpires := now.Add(cfg.AccessTokenTTL)
+	tokenString, err := keys.Sign(token.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Issuer:    cfg.Issuer,
+			Audience:  jwt.ClaimStrings{cfg.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(accessExpires),
+		},
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: familyId,
+	})
+	if err != nil {
+		return nil, model.RefreshToken{}, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, model.RefreshToken{}, err
+	}
+
+	record := model.RefreshToken{
+		UserId:          user.ID,
+		TokenHash:       hashToken(refreshToken),
+		FamilyId:        familyId,
+		AccessJti:       jti,
+		AccessExpiresAt: accessExpires,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(cfg.RefreshTokenTTL),
+	}
+
+	return map[string]any{
+		"token":              tokenString,
+		"expires_in":         accessExpires.Unix(),
+		"refresh_token":      refreshToken,
+		"refresh_expires_in": record.ExpiresAt.Unix(),
+	}, record, nil
+}
+
+// randomToken returns n random bytes, url safe encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how refresh tokens are stored. They are random and long enough that a plain
+// SHA-256 is sufficient, unlike passwords.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
 	"github/com/ammar-nousher-ali/students-api/internal/model"
 	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/utils"
 	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
 	"io"
 	"log/slog"
@@ -23,7 +25,7 @@ func New(storage storage.Storage) http.HandlerFunc {
 
 		var course model.Course
 
-		slog.Info("creating student")
+		slog.InfoContext(r.Context(), "creating student")
 
 		err := json.NewDecoder(r.Body).Decode(&course)
 		if err != nil {
@@ -47,14 +49,18 @@ func New(storage storage.Storage) http.HandlerFunc {
 
 		if error != nil {
 			var validation validator.ValidationErrors
-			errors.As(error, validation)
+			errors.As(error, &validation)
 			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validation, http.StatusBadRequest))
 			return
 		}
 
-		id, err := storage.CreateCourse(course)
+		id, err := storage.CreateCourse(r.Context(), course)
 		if err != nil {
-			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+			if errors.Is(err, model.ErrDuplicate) {
+				response.WriteJson(w, http.StatusConflict, response.GeneralError(fmt.Errorf("course already added"), http.StatusConflict))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
 			return
 		}
 
@@ -64,13 +70,30 @@ func New(storage storage.Storage) http.HandlerFunc {
 	}
 }
 
-func NewBatch(storage storage.Storage) http.HandlerFunc {
+// NewBatch creates up to cfg.MaxSize courses. By default every valid course is created on
+// its own and the result of each one is reported, with mode=atomic they are created in one
+// transaction and none of them is when a single one is invalid or fails.
+func NewBatch(storage storage.Storage, cfg config.Batch) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
+		mode, err := utils.ParseBatchMode(r)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+			return
+		}
+
 		var courses []model.Course
 
-		err := json.NewDecoder(r.Body).Decode(&courses)
+		//the size of the body is bounded before decoding, the item count is only known after
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBytes)
 
+		err = json.NewDecoder(r.Body).Decode(&courses)
+
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			response.WriteJson(w, http.StatusRequestEntityTooLarge, response.GeneralError(fmt.Errorf("a batch body can be at most %d bytes", cfg.MaxBytes), http.StatusRequestEntityTooLarge))
+			return
+		}
 		if errors.Is(err, io.EOF) {
 			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("empty body"), http.StatusBadRequest))
 			return
@@ -81,25 +104,82 @@ func NewBatch(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
+		if len(courses) > cfg.MaxSize {
+			response.WriteJson(w, http.StatusRequestEntityTooLarge, response.GeneralError(fmt.Errorf("a batch can create at most %d courses", cfg.MaxSize), http.StatusRequestEntityTooLarge))
+			return
+		}
+
+		//the reason each course is invalid, empty for the valid ones
+		invalid := make([]string, len(courses))
+		validate := validator.New()
+		now := time.Now()
+		for i := range courses {
+			courses[i].CreatedAt = now
+			courses[i].UpdatedAt = now
+			if err := validate.Struct(courses[i]); err != nil {
+				var validation validator.ValidationErrors
+				errors.As(err, &validation)
+				invalid[i] = response.ValidationMessage(validation)
+			}
+		}
+
 		var batchResponse response.BatchResponse
-		for _, course := range courses {
-			now := time.Now()
-			course.UpdatedAt = now
-			course.CreatedAt = now
-			id, err := storage.CreateCourse(course)
-			if err != nil {
 
-				var reason string
-				if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-					reason = "course already added"
-				} else {
-					reason = err.Error()
+		if mode == model.BatchModeAtomic {
+			for i, reason := range invalid {
+				if reason != "" {
+					response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("item %d: %s", i, reason), http.StatusBadRequest))
+					return
 				}
+			}
+
+			ids, err := storage.CreateCourses(r.Context(), courses)
+			if err != nil {
+				//only a taken course code is the fault of the request, other failures are ours
+				var batchErr *model.BatchError
+				if errors.As(err, &batchErr) && errors.Is(batchErr.Err, model.ErrDuplicate) {
+					response.WriteJson(w, http.StatusConflict, response.GeneralError(fmt.Errorf("batch rolled back, item %d: %s", batchErr.Index, failureReason(batchErr.Err)), http.StatusConflict))
+					return
+				}
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(fmt.Errorf("batch rolled back, %w", err), http.StatusInternalServerError))
+				return
+			}
+
+			for i, id := range ids {
+				courses[i].Id = id
+				batchResponse.Data = append(batchResponse.Data, response.BatchData{
+					Success: true,
+					Data: map[string]any{
+						"course": courses[i],
+					},
+				})
+			}
+
+			slog.InfoContext(r.Context(), "course batch created", slog.Int("count", len(ids)))
+
+			response.WriteJson(w, http.StatusCreated, response.GeneralBatchResponse("success", http.StatusCreated, batchResponse.Data))
+			return
+		}
+
+		for i, course := range courses {
+			if invalid[i] != "" {
+				batchResponse.Data = append(batchResponse.Data, response.BatchData{
+					Success: false,
+					Data: map[string]any{
+						"message": "failed",
+						"reason":  invalid[i],
+					},
+				})
+				continue
+			}
+
+			id, err := storage.CreateCourse(r.Context(), course)
+			if err != nil {
 				batchResponse.Data = append(batchResponse.Data, response.BatchData{
 					Success: false,
 					Data: map[string]any{
 						"message": "failed",
-						"reason":  reason,
+						"reason":  failureReason(err),
 					},
 				})
 			} else {
@@ -121,6 +201,14 @@ func NewBatch(storage storage.Storage) http.HandlerFunc {
 
 }
 
+// failureReason describes why a course of a batch could not be created.
+func failureReason(err error) string {
+	if errors.Is(err, model.ErrDuplicate) {
+		return "course already added"
+	}
+	return err.Error()
+}
+
 func GetById(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -132,7 +220,7 @@ func GetById(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
-		course, err := storage.GetCourseById(id)
+		course, err := storage.GetCourseById(r.Context(), id)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no course found for this id"), http.StatusNotFound))
@@ -152,18 +240,19 @@ func GetById(storage storage.Storage) http.HandlerFunc {
 func GetAll(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		var courses []model.Course
-		courses, err := storage.GetAllCourses()
+		query, err := utils.ParseListQuery(r, model.CourseSortFields, model.CourseFilterFields)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+			return
+		}
+
+		courses, meta, err := storage.GetAllCourses(r.Context(), query)
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no courses found"), http.StatusNotFound))
-				return
-			}
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
 			return
 		}
 
-		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, courses))
+		response.WriteJson(w, http.StatusOK, response.PaginatedResponse("success", http.StatusOK, courses, meta))
 	}
 }
 
@@ -183,13 +272,17 @@ func Update(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
-		course, err := storage.UpdateCourse(id, req)
+		course, err := storage.UpdateCourse(r.Context(), id, req)
 
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no course found for the given id"), http.StatusNotFound))
 				return
 			}
+			if errors.Is(err, model.ErrDuplicate) {
+				response.WriteJson(w, http.StatusConflict, response.GeneralError(fmt.Errorf("course already added"), http.StatusConflict))
+				return
+			}
 
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
 			return
@@ -210,13 +303,17 @@ func Delete(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
-		deletedId, err := storage.DeleteCourseById(id)
+		deletedId, err := storage.DeleteCourseById(r.Context(), id)
 
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no course found for the given id"), http.StatusNotFound))
 				return
 			}
+			if errors.Is(err, model.ErrCourseHasHistory) {
+				response.WriteJson(w, http.StatusConflict, response.GeneralError(err, http.StatusConflict))
+				return
+			}
 
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
 			return
@@ -239,7 +336,7 @@ func Search(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
-		courses, err := storage.SearchCourse(queryStr)
+		courses, err := storage.SearchCourse(r.Context(), queryStr)
 		if err != nil {
 
 			if errors.Is(err, sql.ErrNoRows) {
@@ -255,3 +352,106 @@ func Search(storage storage.Storage) http.HandlerFunc {
 
 	}
 }
+
+func GetPrerequisites(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid ID format. Please enter a valid number"), http.StatusBadRequest))
+			return
+		}
+
+		prerequisites, err := storage.GetCoursePrerequisites(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no course found for this id"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, prerequisites))
+
+	}
+}
+
+func AddPrerequisite(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid ID format. Please enter a valid number"), http.StatusBadRequest))
+			return
+		}
+
+		var req model.Prerequisite
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if errors.Is(err, io.EOF) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("empty body"), http.StatusBadRequest))
+			return
+		}
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			var validation validator.ValidationErrors
+			errors.As(err, &validation)
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validation, http.StatusBadRequest))
+			return
+		}
+
+		prerequisite, err := storage.AddCoursePrerequisite(r.Context(), id, req)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("course or prerequisite course not found"), http.StatusNotFound))
+				return
+			}
+			if errors.Is(err, model.ErrInvalidPrerequisite) || errors.Is(err, model.ErrInvalidGrade) {
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, prerequisite))
+
+	}
+}
+
+func DeletePrerequisite(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid ID format. Please enter a valid number"), http.StatusBadRequest))
+			return
+		}
+
+		prerequisiteId, err := strconv.ParseInt(r.PathValue("prerequisite_id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid prerequisite id"), http.StatusBadRequest))
+			return
+		}
+
+		err = storage.DeleteCoursePrerequisite(r.Context(), id, prerequisiteId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("course %d is not a prerequisite of course %d", prerequisiteId, id), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, map[string]any{
+			"course_id":       id,
+			"prerequisite_id": prerequisiteId,
+		}))
+
+	}
+}
@@ -1,7 +1,9 @@
 package enroll_student
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github/com/ammar-nousher-ali/students-api/internal/model"
 	"github/com/ammar-nousher-ali/students-api/internal/storage"
@@ -34,7 +36,7 @@ func EnrollStudent(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
-		result, err := storage.EnrollStudentInCourse(studentId, req)
+		result, err := storage.EnrollStudentInCourse(r.Context(), studentId, req)
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
 			return
@@ -60,7 +62,7 @@ func GetStudentWithEnrolledCourse(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
-		studentWithCoursesResponse, err := storage.FetchStudentWithEnrolledCourse(studentId)
+		studentWithCoursesResponse, err := storage.FetchStudentWithEnrolledCourse(r.Context(), studentId)
 		if err != nil {
 			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
 			return
@@ -70,3 +72,114 @@ func GetStudentWithEnrolledCourse(storage storage.Storage) http.HandlerFunc {
 
 	}
 }
+
+func GetCourseWaitlist(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		courseId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid course id"), http.StatusBadRequest))
+			return
+		}
+
+		waitlist, err := storage.GetCourseWaitlist(r.Context(), courseId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no course found for this id"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, waitlist))
+
+	}
+}
+
+func GetStudentWaitlist(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		studentId, err := strconv.ParseInt(r.PathValue("student_id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid student id"), http.StatusBadRequest))
+			return
+		}
+
+		waitlist, err := storage.GetStudentWaitlist(r.Context(), studentId)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, waitlist))
+
+	}
+}
+
+func DropCourse(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		studentId, err := strconv.ParseInt(r.PathValue("student_id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid student id"), http.StatusBadRequest))
+			return
+		}
+
+		courseId, err := strconv.ParseInt(r.PathValue("course_id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid course id"), http.StatusBadRequest))
+			return
+		}
+
+		req := model.DropRequest{
+			Courses: []int64{courseId},
+			Reason:  r.URL.Query().Get("reason"),
+		}
+
+		result, err := storage.DropStudentCourses(r.Context(), studentId, req)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		if len(result.FailedCourses) > 0 {
+			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("student is not enrolled in this course"), http.StatusNotFound))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, result))
+
+	}
+}
+
+func DropCourses(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		studentId, err := strconv.ParseInt(r.PathValue("student_id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid student id"), http.StatusBadRequest))
+			return
+		}
+
+		var req model.DropRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid request"), http.StatusBadRequest))
+			return
+		}
+
+		if len(req.Courses) == 0 {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("please provide at least one course to drop"), http.StatusBadRequest))
+			return
+		}
+
+		result, err := storage.DropStudentCourses(r.Context(), studentId, req)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, result))
+
+	}
+}
@@ -0,0 +1,300 @@
+package grade
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/grading"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/transcript"
+	"github/com/ammar-nousher-ali/students-api/internal/utils"
+	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func RecordGrade(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		studentId, err := strconv.ParseInt(r.PathValue("student_id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid student id"), http.StatusBadRequest))
+			return
+		}
+
+		courseId, err := strconv.ParseInt(r.PathValue("course_id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid course id"), http.StatusBadRequest))
+			return
+		}
+
+		var req model.GradeRequest
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if errors.Is(err, io.EOF) {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("empty body"), http.StatusBadRequest))
+			return
+		}
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			var validation validator.ValidationErrors
+			errors.As(err, &validation)
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validation, http.StatusBadRequest))
+			return
+		}
+
+		principal, ok := utils.PrincipalFromContext(r.Context())
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("unauthorized"), http.StatusUnauthorized))
+			return
+		}
+
+		grade, err := storage.RecordGrade(r.Context(), studentId, courseId, req, principal.UserID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("student %d is not enrolled in course %d", studentId, courseId), http.StatusNotFound))
+				return
+			}
+			if errors.Is(err, model.ErrInvalidGrade) {
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("grade recorded", http.StatusOK, grade))
+
+	}
+}
+
+func GetGPA(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		studentId, err := strconv.ParseInt(r.PathValue("student_id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid student id"), http.StatusBadRequest))
+			return
+		}
+
+		grades, err := storage.GetStudentGrades(r.Context(), studentId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("student not found"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, grading.Report(studentId, grades)))
+
+	}
+}
+
+// IssueTranscript issues an official transcript of the student, as JSON or as a PDF when
+// format=pdf is set or the client accepts application/pdf. Every issued transcript is
+// stored so its verification hash can be checked later.
+func IssueTranscript(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		studentId, err := strconv.ParseInt(r.PathValue("student_id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid student id"), http.StatusBadRequest))
+			return
+		}
+
+		format, err := transcriptFormat(r)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+			return
+		}
+
+		student, err := storage.GetStudentById(r.Context(), studentId)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("student not found"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		grades, err := storage.GetStudentGrades(r.Context(), studentId)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		principal, _ := utils.PrincipalFromContext(r.Context())
+
+		issued, err := transcript.Build(student, grades, principal.UserID, time.Now())
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		//render before saving so a failed pdf does not leave an issued transcript behind
+		var pdf bytes.Buffer
+		if format == "pdf" {
+			if err := transcript.WritePDF(&pdf, issued); err != nil {
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+				return
+			}
+		}
+
+		if err := storage.SaveTranscript(r.Context(), issued); err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		writeTranscript(w, http.StatusCreated, "transcript issued", issued, pdf.Bytes())
+
+	}
+}
+
+// ListTranscripts lists the transcripts issued for the student, newest first.
+func ListTranscripts(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		studentId, err := strconv.ParseInt(r.PathValue("student_id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid student id"), http.StatusBadRequest))
+			return
+		}
+
+		if _, err := storage.GetStudentById(r.Context(), studentId); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("student not found"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		transcripts, err := storage.GetStudentTranscripts(r.Context(), studentId)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, transcripts))
+
+	}
+}
+
+// GetTranscript returns a transcript issued for the student, as it was issued. Like
+// IssueTranscript it answers with a PDF when one is asked for.
+func GetTranscript(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		studentId, err := strconv.ParseInt(r.PathValue("student_id"), 10, 64)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid student id"), http.StatusBadRequest))
+			return
+		}
+
+		format, err := transcriptFormat(r)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+			return
+		}
+
+		hash := strings.ToLower(strings.TrimSpace(r.PathValue("hash")))
+
+		issued, err := storage.GetTranscriptByHash(r.Context(), hash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		//a transcript of another student is not found under this one
+		if issued == nil || issued.StudentId != studentId {
+			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no transcript was issued for this student with this hash"), http.StatusNotFound))
+			return
+		}
+
+		var pdf bytes.Buffer
+		if format == "pdf" {
+			if err := transcript.WritePDF(&pdf, *issued); err != nil {
+				response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+				return
+			}
+		}
+
+		writeTranscript(w, http.StatusOK, "success", *issued, pdf.Bytes())
+
+	}
+}
+
+// transcriptFormat returns json or pdf, from the format parameter or else the Accept header.
+func transcriptFormat(r *http.Request) (string, error) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "application/pdf") {
+		format = "pdf"
+	}
+
+	switch format {
+	case "", "json":
+		return "json", nil
+	case "pdf":
+		return "pdf", nil
+	default:
+		return "", fmt.Errorf("invalid format %s, use json or pdf", format)
+	}
+}
+
+// writeTranscript writes the rendered pdf when there is one, the transcript as JSON otherwise.
+func writeTranscript(w http.ResponseWriter, status int, msg string, issued model.Transcript, pdf []byte) {
+	if len(pdf) == 0 {
+		response.WriteJson(w, status, response.GeneralResponse(msg, status, issued))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"transcript-%d.pdf\"", issued.StudentId))
+	w.Header().Set("X-Transcript-Hash", issued.VerificationHash)
+	w.WriteHeader(status)
+	w.Write(pdf)
+}
+
+// VerifyTranscript looks up an issued transcript by the hash printed on it.
+func VerifyTranscript(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		hash := strings.ToLower(strings.TrimSpace(r.PathValue("hash")))
+
+		issued, err := storage.GetTranscriptByHash(r.Context(), hash)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no transcript was issued with this hash"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		//the stored copy is checked too, a modified record must not verify
+		if !transcript.Verify(*issued) || issued.VerificationHash != hash {
+			response.WriteJson(w, http.StatusConflict, response.GeneralError(fmt.Errorf("transcript record does not match its hash"), http.StatusConflict))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("transcript is valid", http.StatusOK, map[string]any{
+			"valid":      true,
+			"transcript": issued,
+		}))
+
+	}
+}
@@ -0,0 +1,125 @@
+package me
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/utils"
+	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Get returns the signed in user along with the student record linked to the account, if any.
+func Get(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		principal, ok := utils.PrincipalFromContext(r.Context())
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("authentication required"), http.StatusUnauthorized))
+			return
+		}
+
+		user, err := storage.GetUserById(r.Context(), principal.UserID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("user not found"), http.StatusNotFound))
+				return
+			}
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		result := map[string]any{"user": user}
+
+		student, err := storage.GetStudentByUserId(r.Context(), principal.UserID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		if err == nil {
+			result["student"] = student
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, result))
+
+	}
+}
+
+func GetCourses(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		student, ok := linkedStudent(w, r, storage)
+		if !ok {
+			return
+		}
+
+		studentWithCoursesResponse, err := storage.FetchStudentWithEnrolledCourse(r.Context(), student.Id)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, studentWithCoursesResponse))
+
+	}
+}
+
+func Enroll(storage storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		student, ok := linkedStudent(w, r, storage)
+		if !ok {
+			return
+		}
+
+		var req model.EnrollRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid request"), http.StatusBadRequest))
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			var validation validator.ValidationErrors
+			errors.As(err, &validation)
+			response.WriteJson(w, http.StatusBadRequest, response.ValidationError(validation, http.StatusBadRequest))
+			return
+		}
+
+		result, err := storage.EnrollStudentInCourse(r.Context(), student.Id, req)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		response.WriteJson(w, http.StatusOK, response.GeneralResponse("success", http.StatusOK, result))
+
+	}
+}
+
+// linkedStudent looks up the student record of the signed in user. It writes the error
+// response itself and reports false when there is none.
+func linkedStudent(w http.ResponseWriter, r *http.Request, storage storage.Storage) (model.Student, bool) {
+	principal, ok := utils.PrincipalFromContext(r.Context())
+	if !ok {
+		response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("authentication required"), http.StatusUnauthorized))
+		return model.Student{}, false
+	}
+
+	student, err := storage.GetStudentByUserId(r.Context(), principal.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no student record is linked to this account"), http.StatusNotFound))
+			return model.Student{}, false
+		}
+		response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+		return model.Student{}, false
+	}
+
+	return student, true
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
 	"github/com/ammar-nousher-ali/students-api/internal/model"
 	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/utils"
 	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
 	"io"
 	"log/slog"
@@ -19,7 +21,7 @@ import (
 
 func New(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		slog.Info("Creating a student")
+		slog.InfoContext(r.Context(), "Creating a student")
 
 		var student model.Student
 
@@ -58,13 +60,18 @@ func New(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
-		lastId, err := storage.CreateStudent(student)
+		lastId, err := storage.CreateStudent(r.Context(), student)
 
-		slog.Info("student created successfully", slog.String("userId", fmt.Sprint(lastId)))
+		slog.InfoContext(r.Context(), "student created successfully", slog.String("userId", fmt.Sprint(lastId)))
 
 		if err != nil {
 
-			if strings.Contains(err.Error(), "already") {
+			if errors.Is(err, model.ErrInvalidUserLink) {
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+				return
+			}
+
+			if errors.Is(err, model.ErrDuplicate) {
 				response.WriteJson(w,
 					http.StatusConflict,
 					response.GeneralError(
@@ -96,11 +103,29 @@ func New(storage storage.Storage) http.HandlerFunc {
 	}
 }
 
-func NewBatch(storage storage.Storage) http.HandlerFunc {
+// NewBatch creates up to cfg.MaxSize students. By default every valid student is created on
+// its own and the result of each one is reported, with mode=atomic they are created in one
+// transaction and none of them is when a single one is invalid or fails.
+func NewBatch(storage storage.Storage, cfg config.Batch) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+
+		mode, err := utils.ParseBatchMode(r)
+		if err != nil {
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+			return
+		}
+
 		var students []model.Student
 
-		err := json.NewDecoder(r.Body).Decode(&students)
+		//the size of the body is bounded before decoding, the item count is only known after
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBytes)
+
+		err = json.NewDecoder(r.Body).Decode(&students)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			response.WriteJson(w, http.StatusRequestEntityTooLarge, response.GeneralError(fmt.Errorf("a batch body can be at most %d bytes", cfg.MaxBytes), http.StatusRequestEntityTooLarge))
+			return
+		}
 		if err != nil {
 			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("invalid request"), http.StatusBadRequest))
 			return
@@ -111,9 +136,73 @@ func NewBatch(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
+		if len(students) > cfg.MaxSize {
+			response.WriteJson(w, http.StatusRequestEntityTooLarge, response.GeneralError(fmt.Errorf("a batch can create at most %d students", cfg.MaxSize), http.StatusRequestEntityTooLarge))
+			return
+		}
+
+		//the reason each student is invalid, empty for the valid ones
+		invalid := make([]string, len(students))
+		validate := validator.New()
+		for i, student := range students {
+			if err := validate.Struct(student); err != nil {
+				var validateErrs validator.ValidationErrors
+				errors.As(err, &validateErrs)
+				invalid[i] = response.ValidationMessage(validateErrs)
+			}
+		}
+
 		var batchResponse response.BatchResponse
-		for _, student := range students {
-			id, err := storage.CreateStudent(student)
+
+		if mode == model.BatchModeAtomic {
+			for i, reason := range invalid {
+				if reason != "" {
+					response.WriteJson(w, http.StatusBadRequest, response.GeneralError(fmt.Errorf("item %d: %s", i, reason), http.StatusBadRequest))
+					return
+				}
+			}
+
+			ids, err := storage.CreateStudents(r.Context(), students)
+			if err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, model.ErrInvalidUserLink) {
+					status = http.StatusBadRequest
+				} else if errors.Is(err, model.ErrDuplicate) {
+					status = http.StatusConflict
+				}
+				response.WriteJson(w, status, response.GeneralError(fmt.Errorf("batch rolled back, %w", err), status))
+				return
+			}
+
+			for _, id := range ids {
+				batchResponse.Data = append(batchResponse.Data, response.BatchData{
+					Success: true,
+					Data: map[string]any{
+						"message": "success",
+						"id":      id,
+					},
+				})
+			}
+
+			slog.InfoContext(r.Context(), "student batch created", slog.Int("count", len(ids)))
+
+			response.WriteJson(w, http.StatusCreated, response.GeneralBatchResponse("success", http.StatusCreated, batchResponse.Data))
+			return
+		}
+
+		for i, student := range students {
+			if invalid[i] != "" {
+				batchResponse.Data = append(batchResponse.Data, response.BatchData{
+					Success: false,
+					Data: map[string]any{
+						"message": "failed",
+						"reason":  invalid[i],
+					},
+				})
+				continue
+			}
+
+			id, err := storage.CreateStudent(r.Context(), student)
 
 			if err != nil {
 				batchResponse.Data = append(batchResponse.Data, response.BatchData{
@@ -146,7 +235,7 @@ func GetById(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		id := r.PathValue("id")
-		slog.Info("getting a student", slog.String("id", id))
+		slog.InfoContext(r.Context(), "getting a student", slog.String("id", id))
 
 		intId, err := strconv.ParseInt(id, 10, 64)
 		if err != nil {
@@ -162,12 +251,12 @@ func GetById(storage storage.Storage) http.HandlerFunc {
 
 		}
 
-		student, err := storage.GetStudentById(intId)
+		student, err := storage.GetStudentById(r.Context(), intId)
 		if err != nil {
-			slog.Error("error getting user", slog.String("id", id))
+			slog.ErrorContext(r.Context(), "error getting user", slog.String("id", id))
 
 			if errors.Is(err, sql.ErrNoRows) {
-				slog.Error("sql no rows err", "error", err)
+				slog.ErrorContext(r.Context(), "sql no rows err", "error", err)
 				response.WriteJson(w, http.StatusNotFound, response.GeneralError(fmt.Errorf("no student found for the given id = %s", id), http.StatusNotFound))
 				return
 			}
@@ -197,18 +286,26 @@ func GetById(storage storage.Storage) http.HandlerFunc {
 func GetList(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		slog.Info("getting all students")
-		students, err := storage.GetStudents()
+		slog.InfoContext(r.Context(), "getting all students")
+
+		query, err := utils.ParseListQuery(r, model.StudentSortFields, model.StudentFilterFields)
 		if err != nil {
-			response.WriteJson(w, http.StatusInternalServerError, err)
+			response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+			return
+		}
+
+		students, meta, err := storage.GetStudents(r.Context(), query)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
 			return
 		}
 
 		response.WriteJson(w, http.StatusOK,
-			response.GeneralResponse(
+			response.PaginatedResponse(
 				"Students retrieved successfully",
 				http.StatusOK,
 				students,
+				meta,
 			),
 		)
 
@@ -218,7 +315,7 @@ func GetList(storage storage.Storage) http.HandlerFunc {
 func DeleteStudent(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		slog.Info("deleting student")
+		slog.InfoContext(r.Context(), "deleting student")
 		id := r.PathValue("id")
 		intId, err := strconv.ParseInt(id, 10, 64)
 		if err != nil {
@@ -235,10 +332,10 @@ func DeleteStudent(storage storage.Storage) http.HandlerFunc {
 
 		}
 
-		slog.Info(fmt.Sprintf("id to be deleted %d", intId))
-		deletedStudentId, err := storage.DeleteStudentById(intId)
+		slog.InfoContext(r.Context(), fmt.Sprintf("id to be deleted %d", intId))
+		deletedStudentId, err := storage.DeleteStudentById(r.Context(), intId)
 		if err != nil {
-			slog.Info("error while deleting student")
+			slog.InfoContext(r.Context(), "error while deleting student")
 
 			if errors.Is(err, sql.ErrNoRows) {
 				noStudentFoundErr := fmt.Errorf("no student found for the id %d", intId)
@@ -267,7 +364,7 @@ func DeleteStudent(storage storage.Storage) http.HandlerFunc {
 
 			return
 		}
-		slog.Info(fmt.Sprintf("deleted student id %d", deletedStudentId))
+		slog.InfoContext(r.Context(), fmt.Sprintf("deleted student id %d", deletedStudentId))
 		response.WriteJson(w, http.StatusOK,
 			response.GeneralResponse(
 				"Student deleted successfully",
@@ -281,7 +378,7 @@ func DeleteStudent(storage storage.Storage) http.HandlerFunc {
 func UpdateStudent(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		slog.Info("Updating student")
+		slog.InfoContext(r.Context(), "Updating student")
 
 		var req model.StudentUpdateRequest
 
@@ -324,8 +421,13 @@ func UpdateStudent(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
-		updatedId, err := storage.UpdateStudentById(studentId, req)
+		updatedId, err := storage.UpdateStudentById(r.Context(), studentId, req)
 		if err != nil {
+			if errors.Is(err, model.ErrInvalidUserLink) {
+				response.WriteJson(w, http.StatusBadRequest, response.GeneralError(err, http.StatusBadRequest))
+				return
+			}
+
 			if errors.Is(err, sql.ErrNoRows) {
 				response.WriteJson(w,
 					http.StatusNotFound,
@@ -363,7 +465,7 @@ func UpdateStudent(storage storage.Storage) http.HandlerFunc {
 func SearchStudent(storage storage.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		slog.Info("srarching student")
+		slog.InfoContext(r.Context(), "srarching student")
 
 		query := r.URL.Query().Get("query")
 		if strings.ToLower(query) == "" {
@@ -380,7 +482,7 @@ func SearchStudent(storage storage.Storage) http.HandlerFunc {
 			return
 		}
 
-		students, err := storage.SearchStudent(query)
+		students, err := storage.SearchStudent(r.Context(), query)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				response.WriteJson(w,
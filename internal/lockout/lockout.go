@@ -0,0 +1,144 @@
+package lockout
+
+import (
+	"context"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Guard throttles sign in attempts. Failures are counted per account, keyed by email so
+// unknown emails are throttled exactly like existing ones, and per client address.
+//
+// Attempts that are still checking the password count as failures made right now, so
+// parallel guesses see each other. They are tracked in memory, every instance of the API
+// throttles the attempts it serves itself on top of the shared counts.
+type Guard struct {
+	storage storage.Storage
+	cfg     config.Login
+
+	mu      sync.Mutex
+	pending map[string]int // running attempts by scope and subject
+}
+
+func New(storage storage.Storage, cfg config.Login) *Guard {
+	return &Guard{storage: storage, cfg: cfg, pending: map[string]int{}}
+}
+
+// Begin checks whether an attempt for email from ip may go ahead. It returns how long the
+// attempt has to wait, zero when it may go ahead. An attempt that goes ahead is pending until
+// release is called, after its outcome was recorded with Fail or Succeed.
+func (g *Guard) Begin(ctx context.Context, email string, ip string, now time.Time) (release func(), wait time.Duration, err error) {
+	account := pendingKey(model.LoginScopeAccount, normalize(email))
+	address := pendingKey(model.LoginScopeIP, ip)
+
+	//the lock only covers the pending counts, the recorded failures are read after it. The
+	//attempt is counted before the others are looked at, so of two parallel attempts one
+	//always counts the other. A running attempt that records its failure meanwhile is counted
+	//twice, which errs on the side of throttling.
+	g.mu.Lock()
+	accountPending, addressPending := g.pending[account], g.pending[address]
+	g.pending[account]++
+	g.pending[address]++
+	g.mu.Unlock()
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			g.done(account)
+			g.done(address)
+		})
+	}
+
+	accountFailures, err := g.storage.GetLoginFailures(ctx, model.LoginScopeAccount, normalize(email))
+	if err != nil {
+		release()
+		return nil, 0, err
+	}
+
+	addressFailures, err := g.storage.GetLoginFailures(ctx, model.LoginScopeIP, ip)
+	if err != nil {
+		release()
+		return nil, 0, err
+	}
+
+	wait = max(
+		g.wait(withPending(accountFailures, accountPending, now), g.cfg.FreeAttempts, g.cfg.LockoutThreshold, now),
+		g.wait(withPending(addressFailures, addressPending, now), g.cfg.IPFreeAttempts, g.cfg.IPLockoutThreshold, now),
+	)
+	if wait > 0 {
+		release()
+		return nil, wait, nil
+	}
+
+	return release, 0, nil
+}
+
+// withPending adds the running attempts to the recorded failures, as if they had just failed.
+func withPending(failures model.LoginFailures, running int, now time.Time) model.LoginFailures {
+	if running > 0 {
+		failures.Failures += running
+		failures.LastFailedAt = now
+	}
+	return failures
+}
+
+func (g *Guard) done(key string) {
+	g.pending[key]--
+	if g.pending[key] <= 0 {
+		delete(g.pending, key)
+	}
+}
+
+func pendingKey(scope string, subject string) string {
+	return scope + ":" + subject
+}
+
+// Fail records a failed attempt for email from ip.
+func (g *Guard) Fail(ctx context.Context, email string, ip string, now time.Time) error {
+	since := now.Add(-g.cfg.FailureWindow)
+
+	if _, err := g.storage.RecordLoginFailure(ctx, model.LoginScopeAccount, normalize(email), now, since); err != nil {
+		return err
+	}
+
+	_, err := g.storage.RecordLoginFailure(ctx, model.LoginScopeIP, ip, now, since)
+	return err
+}
+
+// Succeed forgets the failures of the account. The failures of the address are kept, a
+// single valid account must not reset an attack coming from the same address.
+func (g *Guard) Succeed(ctx context.Context, email string) error {
+	return g.storage.ClearLoginFailures(ctx, model.LoginScopeAccount, normalize(email))
+}
+
+// Unlock lifts the lockout of an account.
+func (g *Guard) Unlock(ctx context.Context, email string) error {
+	return g.storage.ClearLoginFailures(ctx, model.LoginScopeAccount, normalize(email))
+}
+
+func (g *Guard) wait(failures model.LoginFailures, free int, threshold int, now time.Time) time.Duration {
+	if failures.Failures <= free {
+		return 0
+	}
+
+	delay := g.cfg.LockoutDuration
+	if failures.Failures < threshold {
+		delay = g.cfg.BaseDelay
+		for i := free + 1; i < failures.Failures && delay < g.cfg.MaxDelay; i++ {
+			delay *= 2
+		}
+		delay = min(delay, g.cfg.MaxDelay)
+	}
+
+	return max(failures.LastFailedAt.Add(delay).Sub(now), 0)
+}
+
+func normalize(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,69 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSMTPMailerStalledServer(t *testing.T) {
+	//accepts connections but never sends the greeting
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(io.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	mail := &SMTPMailer{cfg: config.Mailer{Host: host, Port: portNumber, From: "no-reply@example.com"}}
+
+	tests := []struct {
+		name   string
+		ctx    func() (context.Context, context.CancelFunc)
+		target error
+	}{
+		{"deadline", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 100*time.Millisecond)
+		}, context.DeadlineExceeded},
+		{"cancel", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(100*time.Millisecond, cancel)
+			return ctx, cancel
+		}, context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			start := time.Now()
+			err := mail.Send(ctx, Message{To: "user@example.com", Subject: "subject", Body: "body"})
+			if !errors.Is(err, tt.target) {
+				t.Errorf("got %v, want %v", err, tt.target)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("send returned after %s", elapsed)
+			}
+		})
+	}
+}
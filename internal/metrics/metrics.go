@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "students_api"
+
+// scrapes do not carry a context, the business totals get this long to be counted
+const statsTimeout = 5 * time.Second
+
+// Metrics holds the collectors of the service, registered in a registry of their own.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	queryDuration   *prometheus.HistogramVec
+	queryErrors     *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, route pattern and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_query_duration_seconds",
+			Help:      "Duration of the storage calls by method.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"method"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_errors_total",
+			Help:      "Failed storage calls by method, not found results are not counted.",
+		}, []string{"method"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.queryDuration,
+		m.queryErrors,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) ObserveRequest(method string, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(method, route, code).Inc()
+	m.requestDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+// observeQuery is deferred by the instrumented storage, err points at the named error
+// result so it is read once the call returned.
+func (m *Metrics) observeQuery(method string, start time.Time, err *error) {
+	m.queryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if *err != nil && !errors.Is(*err, sql.ErrNoRows) {
+		m.queryErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// RegisterDB exports the connection pool statistics of db.
+func (m *Metrics) RegisterDB(db *sql.DB, name string) error {
+	return m.registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterStats exports the business totals of storage, read on every scrape.
+func (m *Metrics) RegisterStats(storage storage.Storage) error {
+	return m.registry.Register(&statsCollector{storage: storage})
+}
+
+var (
+	activeStudentsDesc = prometheus.NewDesc(namespace+"_active_students", "Students with the active status.", nil, nil)
+	coursesDesc        = prometheus.NewDesc(namespace+"_courses", "Courses.", nil, nil)
+	enrollmentsDesc    = prometheus.NewDesc(namespace+"_active_enrollments", "Enrollments that were not dropped.", nil, nil)
+	waitlistedDesc     = prometheus.NewDesc(namespace+"_waitlisted", "Waitlist entries still waiting for a seat.", nil, nil)
+)
+
+type statsCollector struct {
+	storage storage.Storage
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeStudentsDesc
+	ch <- coursesDesc
+	ch <- enrollmentsDesc
+	ch <- waitlistedDesc
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+
+	stats, err := c.storage.GetStats(ctx)
+	if err != nil {
+		slog.Error("collecting business metrics failed", slog.String("error", err.Error()))
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(activeStudentsDesc, prometheus.GaugeValue, float64(stats.ActiveStudents))
+	ch <- prometheus.MustNewConstMetric(coursesDesc, prometheus.GaugeValue, float64(stats.Courses))
+	ch <- prometheus.MustNewConstMetric(enrollmentsDesc, prometheus.GaugeValue, float64(stats.ActiveEnrollments))
+	ch <- prometheus.MustNewConstMetric(waitlistedDesc, prometheus.GaugeValue, float64(stats.Waitlisted))
+}
@@ -0,0 +1,288 @@
+package metrics
+
+import (
+	"context"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"time"
+)
+
+// InstrumentStorage wraps storage so every call is timed and its errors counted.
+func (m *Metrics) InstrumentStorage(storage storage.Storage) storage.Storage {
+	return &instrumentedStorage{next: storage, metrics: m}
+}
+
+type instrumentedStorage struct {
+	next    storage.Storage
+	metrics *Metrics
+}
+
+func (s *instrumentedStorage) CreateStudent(ctx context.Context, student model.Student) (_ int64, err error) {
+	defer s.metrics.observeQuery("CreateStudent", time.Now(), &err)
+	return s.next.CreateStudent(ctx, student)
+}
+
+func (s *instrumentedStorage) CreateStudents(ctx context.Context, students []model.Student) (_ []int64, err error) {
+	defer s.metrics.observeQuery("CreateStudents", time.Now(), &err)
+	return s.next.CreateStudents(ctx, students)
+}
+
+func (s *instrumentedStorage) GetStudentById(ctx context.Context, id int64) (_ model.Student, err error) {
+	defer s.metrics.observeQuery("GetStudentById", time.Now(), &err)
+	return s.next.GetStudentById(ctx, id)
+}
+
+func (s *instrumentedStorage) GetStudents(ctx context.Context, query model.ListQuery) (_ []model.Student, _ *model.PageMeta, err error) {
+	defer s.metrics.observeQuery("GetStudents", time.Now(), &err)
+	return s.next.GetStudents(ctx, query)
+}
+
+func (s *instrumentedStorage) DeleteStudentById(ctx context.Context, id int64) (_ int64, err error) {
+	defer s.metrics.observeQuery("DeleteStudentById", time.Now(), &err)
+	return s.next.DeleteStudentById(ctx, id)
+}
+
+func (s *instrumentedStorage) UpdateStudentById(ctx context.Context, id int64, req model.StudentUpdateRequest) (_ int64, err error) {
+	defer s.metrics.observeQuery("UpdateStudentById", time.Now(), &err)
+	return s.next.UpdateStudentById(ctx, id, req)
+}
+
+func (s *instrumentedStorage) GetStudentByUserId(ctx context.Context, userId int64) (_ model.Student, err error) {
+	defer s.metrics.observeQuery("GetStudentByUserId", time.Now(), &err)
+	return s.next.GetStudentByUserId(ctx, userId)
+}
+
+func (s *instrumentedStorage) SearchStudent(ctx context.Context, query string) (_ *[]model.Student, err error) {
+	defer s.metrics.observeQuery("SearchStudent", time.Now(), &err)
+	return s.next.SearchStudent(ctx, query)
+}
+
+func (s *instrumentedStorage) CreateUser(ctx context.Context, user model.User) (_ int64, err error) {
+	defer s.metrics.observeQuery("CreateUser", time.Now(), &err)
+	return s.next.CreateUser(ctx, user)
+}
+
+func (s *instrumentedStorage) IsEmailTaken(ctx context.Context, email string) (_ bool, err error) {
+	defer s.metrics.observeQuery("IsEmailTaken", time.Now(), &err)
+	return s.next.IsEmailTaken(ctx, email)
+}
+
+func (s *instrumentedStorage) GetUserByEmail(ctx context.Context, email string) (_ *model.User, err error) {
+	defer s.metrics.observeQuery("GetUserByEmail", time.Now(), &err)
+	return s.next.GetUserByEmail(ctx, email)
+}
+
+func (s *instrumentedStorage) GetUserById(ctx context.Context, id int64) (_ *model.User, err error) {
+	defer s.metrics.observeQuery("GetUserById", time.Now(), &err)
+	return s.next.GetUserById(ctx, id)
+}
+
+func (s *instrumentedStorage) SetUserRole(ctx context.Context, id int64, role string) (err error) {
+	defer s.metrics.observeQuery("SetUserRole", time.Now(), &err)
+	return s.next.SetUserRole(ctx, id, role)
+}
+
+func (s *instrumentedStorage) CreateRefreshToken(ctx context.Context, token model.RefreshToken) (err error) {
+	defer s.metrics.observeQuery("CreateRefreshToken", time.Now(), &err)
+	return s.next.CreateRefreshToken(ctx, token)
+}
+
+func (s *instrumentedStorage) GetRefreshToken(ctx context.Context, tokenHash string) (_ *model.RefreshToken, err error) {
+	defer s.metrics.observeQuery("GetRefreshToken", time.Now(), &err)
+	return s.next.GetRefreshToken(ctx, tokenHash)
+}
+
+func (s *instrumentedStorage) RotateRefreshToken(ctx context.Context, oldId int64, next model.RefreshToken) (err error) {
+	defer s.metrics.observeQuery("RotateRefreshToken", time.Now(), &err)
+	return s.next.RotateRefreshToken(ctx, oldId, next)
+}
+
+func (s *instrumentedStorage) RevokeSession(ctx context.Context, familyId string) (err error) {
+	defer s.metrics.observeQuery("RevokeSession", time.Now(), &err)
+	return s.next.RevokeSession(ctx, familyId)
+}
+
+func (s *instrumentedStorage) RevokeUserSessions(ctx context.Context, userId int64) (err error) {
+	defer s.metrics.observeQuery("RevokeUserSessions", time.Now(), &err)
+	return s.next.RevokeUserSessions(ctx, userId)
+}
+
+func (s *instrumentedStorage) RevokeAccessToken(ctx context.Context, jti string, userId int64, expiresAt time.Time) (err error) {
+	defer s.metrics.observeQuery("RevokeAccessToken", time.Now(), &err)
+	return s.next.RevokeAccessToken(ctx, jti, userId, expiresAt)
+}
+
+func (s *instrumentedStorage) IsTokenRevoked(ctx context.Context, jti string) (_ bool, err error) {
+	defer s.metrics.observeQuery("IsTokenRevoked", time.Now(), &err)
+	return s.next.IsTokenRevoked(ctx, jti)
+}
+
+func (s *instrumentedStorage) CreateAccountToken(ctx context.Context, token model.AccountToken) (err error) {
+	defer s.metrics.observeQuery("CreateAccountToken", time.Now(), &err)
+	return s.next.CreateAccountToken(ctx, token)
+}
+
+func (s *instrumentedStorage) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (_ int64, err error) {
+	defer s.metrics.observeQuery("ResetPassword", time.Now(), &err)
+	return s.next.ResetPassword(ctx, tokenHash, passwordHash)
+}
+
+func (s *instrumentedStorage) VerifyEmail(ctx context.Context, tokenHash string) (_ int64, err error) {
+	defer s.metrics.observeQuery("VerifyEmail", time.Now(), &err)
+	return s.next.VerifyEmail(ctx, tokenHash)
+}
+
+func (s *instrumentedStorage) GetLoginFailures(ctx context.Context, scope string, subject string) (_ model.LoginFailures, err error) {
+	defer s.metrics.observeQuery("GetLoginFailures", time.Now(), &err)
+	return s.next.GetLoginFailures(ctx, scope, subject)
+}
+
+func (s *instrumentedStorage) RecordLoginFailure(ctx context.Context, scope string, subject string, at time.Time, since time.Time) (_ model.LoginFailures, err error) {
+	defer s.metrics.observeQuery("RecordLoginFailure", time.Now(), &err)
+	return s.next.RecordLoginFailure(ctx, scope, subject, at, since)
+}
+
+func (s *instrumentedStorage) ClearLoginFailures(ctx context.Context, scope string, subject string) (err error) {
+	defer s.metrics.observeQuery("ClearLoginFailures", time.Now(), &err)
+	return s.next.ClearLoginFailures(ctx, scope, subject)
+}
+
+func (s *instrumentedStorage) CreateCourse(ctx context.Context, course model.Course) (_ int64, err error) {
+	defer s.metrics.observeQuery("CreateCourse", time.Now(), &err)
+	return s.next.CreateCourse(ctx, course)
+}
+
+func (s *instrumentedStorage) CreateCourses(ctx context.Context, courses []model.Course) (_ []int64, err error) {
+	defer s.metrics.observeQuery("CreateCourses", time.Now(), &err)
+	return s.next.CreateCourses(ctx, courses)
+}
+
+func (s *instrumentedStorage) GetCourseById(ctx context.Context, id int64) (_ *model.Course, err error) {
+	defer s.metrics.observeQuery("GetCourseById", time.Now(), &err)
+	return s.next.GetCourseById(ctx, id)
+}
+
+func (s *instrumentedStorage) GetAllCourses(ctx context.Context, query model.ListQuery) (_ []model.Course, _ *model.PageMeta, err error) {
+	defer s.metrics.observeQuery("GetAllCourses", time.Now(), &err)
+	return s.next.GetAllCourses(ctx, query)
+}
+
+func (s *instrumentedStorage) UpdateCourse(ctx context.Context, id int64, req model.CourseUpdateRequest) (_ *model.Course, err error) {
+	defer s.metrics.observeQuery("UpdateCourse", time.Now(), &err)
+	return s.next.UpdateCourse(ctx, id, req)
+}
+
+func (s *instrumentedStorage) DeleteCourseById(ctx context.Context, id int64) (_ int64, err error) {
+	defer s.metrics.observeQuery("DeleteCourseById", time.Now(), &err)
+	return s.next.DeleteCourseById(ctx, id)
+}
+
+func (s *instrumentedStorage) SearchCourse(ctx context.Context, query string) (_ *[]model.Course, err error) {
+	defer s.metrics.observeQuery("SearchCourse", time.Now(), &err)
+	return s.next.SearchCourse(ctx, query)
+}
+
+func (s *instrumentedStorage) GetCoursePrerequisites(ctx context.Context, courseId int64) (_ []model.Prerequisite, err error) {
+	defer s.metrics.observeQuery("GetCoursePrerequisites", time.Now(), &err)
+	return s.next.GetCoursePrerequisites(ctx, courseId)
+}
+
+func (s *instrumentedStorage) AddCoursePrerequisite(ctx context.Context, courseId int64, prerequisite model.Prerequisite) (_ *model.Prerequisite, err error) {
+	defer s.metrics.observeQuery("AddCoursePrerequisite", time.Now(), &err)
+	return s.next.AddCoursePrerequisite(ctx, courseId, prerequisite)
+}
+
+func (s *instrumentedStorage) DeleteCoursePrerequisite(ctx context.Context, courseId int64, prerequisiteId int64) (err error) {
+	defer s.metrics.observeQuery("DeleteCoursePrerequisite", time.Now(), &err)
+	return s.next.DeleteCoursePrerequisite(ctx, courseId, prerequisiteId)
+}
+
+func (s *instrumentedStorage) EnrollStudentInCourse(ctx context.Context, studentId int64, courses model.EnrollRequest) (_ *model.EnrollmentResponse, err error) {
+	defer s.metrics.observeQuery("EnrollStudentInCourse", time.Now(), &err)
+	return s.next.EnrollStudentInCourse(ctx, studentId, courses)
+}
+
+func (s *instrumentedStorage) FetchStudentWithEnrolledCourse(ctx context.Context, studentId int64) (_ *model.StudentWithCoursesResponse, err error) {
+	defer s.metrics.observeQuery("FetchStudentWithEnrolledCourse", time.Now(), &err)
+	return s.next.FetchStudentWithEnrolledCourse(ctx, studentId)
+}
+
+func (s *instrumentedStorage) DropStudentCourses(ctx context.Context, studentId int64, req model.DropRequest) (_ *model.DropResponse, err error) {
+	defer s.metrics.observeQuery("DropStudentCourses", time.Now(), &err)
+	return s.next.DropStudentCourses(ctx, studentId, req)
+}
+
+func (s *instrumentedStorage) RecordGrade(ctx context.Context, studentId int64, courseId int64, req model.GradeRequest, gradedBy int64) (_ *model.CourseGrade, err error) {
+	defer s.metrics.observeQuery("RecordGrade", time.Now(), &err)
+	return s.next.RecordGrade(ctx, studentId, courseId, req, gradedBy)
+}
+
+func (s *instrumentedStorage) GetStudentGrades(ctx context.Context, studentId int64) (_ []model.CourseGrade, err error) {
+	defer s.metrics.observeQuery("GetStudentGrades", time.Now(), &err)
+	return s.next.GetStudentGrades(ctx, studentId)
+}
+
+func (s *instrumentedStorage) SaveTranscript(ctx context.Context, transcript model.Transcript) (err error) {
+	defer s.metrics.observeQuery("SaveTranscript", time.Now(), &err)
+	return s.next.SaveTranscript(ctx, transcript)
+}
+
+func (s *instrumentedStorage) GetTranscriptByHash(ctx context.Context, hash string) (_ *model.Transcript, err error) {
+	defer s.metrics.observeQuery("GetTranscriptByHash", time.Now(), &err)
+	return s.next.GetTranscriptByHash(ctx, hash)
+}
+
+func (s *instrumentedStorage) GetStudentTranscripts(ctx context.Context, studentId int64) (_ []model.Transcript, err error) {
+	defer s.metrics.observeQuery("GetStudentTranscripts", time.Now(), &err)
+	return s.next.GetStudentTranscripts(ctx, studentId)
+}
+
+func (s *instrumentedStorage) CreateCourseSession(ctx context.Context, courseId int64, session model.CourseSession) (_ *model.CourseSession, err error) {
+	defer s.metrics.observeQuery("CreateCourseSession", time.Now(), &err)
+	return s.next.CreateCourseSession(ctx, courseId, session)
+}
+
+func (s *instrumentedStorage) GetCourseSessions(ctx context.Context, courseId int64) (_ []model.CourseSession, err error) {
+	defer s.metrics.observeQuery("GetCourseSessions", time.Now(), &err)
+	return s.next.GetCourseSessions(ctx, courseId)
+}
+
+func (s *instrumentedStorage) DeleteCourseSession(ctx context.Context, courseId int64, sessionId int64) (err error) {
+	defer s.metrics.observeQuery("DeleteCourseSession", time.Now(), &err)
+	return s.next.DeleteCourseSession(ctx, courseId, sessionId)
+}
+
+func (s *instrumentedStorage) MarkAttendance(ctx context.Context, courseId int64, sessionId int64, req model.AttendanceRequest, markedBy int64) (_ *model.AttendanceResponse, err error) {
+	defer s.metrics.observeQuery("MarkAttendance", time.Now(), &err)
+	return s.next.MarkAttendance(ctx, courseId, sessionId, req, markedBy)
+}
+
+func (s *instrumentedStorage) GetSessionAttendance(ctx context.Context, courseId int64, sessionId int64) (_ []model.AttendanceRecord, err error) {
+	defer s.metrics.observeQuery("GetSessionAttendance", time.Now(), &err)
+	return s.next.GetSessionAttendance(ctx, courseId, sessionId)
+}
+
+func (s *instrumentedStorage) GetCourseAttendance(ctx context.Context, courseId int64) (_ []model.AttendanceSummary, err error) {
+	defer s.metrics.observeQuery("GetCourseAttendance", time.Now(), &err)
+	return s.next.GetCourseAttendance(ctx, courseId)
+}
+
+func (s *instrumentedStorage) GetStudentAttendance(ctx context.Context, studentId int64) (_ []model.AttendanceSummary, err error) {
+	defer s.metrics.observeQuery("GetStudentAttendance", time.Now(), &err)
+	return s.next.GetStudentAttendance(ctx, studentId)
+}
+
+func (s *instrumentedStorage) GetCourseWaitlist(ctx context.Context, courseId int64) (_ []model.WaitlistEntry, err error) {
+	defer s.metrics.observeQuery("GetCourseWaitlist", time.Now(), &err)
+	return s.next.GetCourseWaitlist(ctx, courseId)
+}
+
+func (s *instrumentedStorage) GetStudentWaitlist(ctx context.Context, studentId int64) (_ []model.WaitlistEntry, err error) {
+	defer s.metrics.observeQuery("GetStudentWaitlist", time.Now(), &err)
+	return s.next.GetStudentWaitlist(ctx, studentId)
+}
+
+func (s *instrumentedStorage) GetStats(ctx context.Context) (_ model.Stats, err error) {
+	defer s.metrics.observeQuery("GetStats", time.Now(), &err)
+	return s.next.GetStats(ctx)
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CORS applies the configured cross origin policy. Requests from origins that are not
+// allowed get no CORS headers, their preflight requests reach the router like any other
+// OPTIONS request and the browser blocks the call.
+func CORS(cfg config.CORS, next http.Handler) http.Handler {
+
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		origin := r.Header.Get("Origin")
+
+		//the answer depends on the origin, shared caches must not mix them up
+		w.Header().Add("Vary", "Origin")
+
+		if origin == "" || !originAllowed(cfg.AllowedOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		//config.MustLoad refuses * together with credentials, any origin could read the
+		//responses of its signed in users
+		if slices.Contains(cfg.AllowedOrigins, "*") {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if cfg.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if exposed != "" {
+			w.Header().Set("Access-Control-Expose-Headers", exposed)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// originAllowed matches origin against the allowed origins. "https://*.example.com" allows
+// any subdomain of example.com over https, but not example.com itself.
+func originAllowed(allowed []string, origin string) bool {
+	for _, pattern := range allowed {
+		if pattern == "*" || strings.EqualFold(pattern, origin) {
+			return true
+		}
+
+		prefix, suffix, ok := strings.Cut(pattern, "*")
+		if !ok {
+			continue
+		}
+
+		if len(origin) > len(prefix)+len(suffix) &&
+			strings.EqualFold(origin[:len(prefix)], prefix) &&
+			strings.EqualFold(origin[len(origin)-len(suffix):], suffix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"exact", []string{"https://app.example.com"}, "https://app.example.com", true},
+		{"exact ignores case", []string{"https://App.Example.com"}, "https://app.example.COM", true},
+		{"other host", []string{"https://app.example.com"}, "https://evil.example.com", false},
+		{"other scheme", []string{"https://app.example.com"}, "http://app.example.com", false},
+		{"other port", []string{"https://app.example.com"}, "https://app.example.com:8443", false},
+		{"any origin", []string{"*"}, "https://anything.test", true},
+		{"subdomain", []string{"https://*.example.com"}, "https://app.example.com", true},
+		{"nested subdomain", []string{"https://*.example.com"}, "https://a.b.example.com", true},
+		{"subdomain ignores case", []string{"https://*.example.com"}, "HTTPS://APP.EXAMPLE.COM", true},
+		{"apex of a wildcard", []string{"https://*.example.com"}, "https://example.com", false},
+		{"empty label", []string{"https://*.example.com"}, "https://.example.com", false},
+		{"wildcard other scheme", []string{"https://*.example.com"}, "http://app.example.com", false},
+		{"suffix lookalike", []string{"https://*.example.com"}, "https://app.example.com.evil.test", false},
+		{"domain lookalike", []string{"https://*.example.com"}, "https://appexample.com", false},
+		{"wildcard with port", []string{"https://*.example.com"}, "https://app.example.com:8443", false},
+		{"second pattern", []string{"https://app.example.com", "https://*.example.org"}, "https://docs.example.org", true},
+		{"nothing allowed", nil, "https://app.example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := originAllowed(tt.allowed, tt.origin); got != tt.want {
+				t.Errorf("originAllowed(%q, %q) = %v, want %v", tt.allowed, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	base := config.CORS{
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		ExposedHeaders: []string{"Retry-After"},
+		MaxAge:         10 * time.Minute,
+	}
+
+	withOrigins := func(credentials bool, origins ...string) config.CORS {
+		cfg := base
+		cfg.AllowedOrigins = origins
+		cfg.AllowCredentials = credentials
+		return cfg
+	}
+
+	tests := []struct {
+		name        string
+		cfg         config.CORS
+		method      string
+		origin      string
+		allowOrigin string // empty when the origin gets no CORS headers
+		credentials bool
+		preflight   bool
+	}{
+		{"listed origin with credentials", withOrigins(true, "https://app.example.com"), http.MethodGet, "https://app.example.com", "https://app.example.com", true, false},
+		{"wildcard subdomain echoes the origin", withOrigins(true, "https://*.example.com"), http.MethodGet, "https://app.example.com", "https://app.example.com", true, false},
+		{"any origin without credentials", withOrigins(false, "*"), http.MethodGet, "https://anything.test", "*", false, false},
+		{"origin not allowed", withOrigins(true, "https://app.example.com"), http.MethodGet, "https://evil.test", "", false, false},
+		{"same origin request", withOrigins(true, "https://app.example.com"), http.MethodGet, "", "", false, false},
+		{"preflight", withOrigins(true, "https://app.example.com"), http.MethodOptions, "https://app.example.com", "https://app.example.com", true, true},
+		{"preflight of an origin not allowed", withOrigins(true, "https://app.example.com"), http.MethodOptions, "https://evil.test", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached := false
+			handler := CORS(tt.cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+			}))
+
+			r := httptest.NewRequest(tt.method, "/api/students", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin %q, want %q", got, tt.allowOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("credentials allowed %v, want %v", got, tt.credentials)
+			}
+			if w.Header().Get("Access-Control-Allow-Origin") == "*" && w.Header().Get("Access-Control-Allow-Credentials") != "" {
+				t.Error("any origin is allowed together with credentials")
+			}
+			if w.Header().Get("Vary") == "" {
+				t.Error("no Vary header")
+			}
+
+			if tt.preflight {
+				if reached || w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") != "GET, POST" || w.Header().Get("Access-Control-Max-Age") != "600" {
+					t.Errorf("preflight answered %d with %v, reached the handler %v", w.Code, w.Header(), reached)
+				}
+			} else if !reached {
+				t.Error("the request did not reach the handler")
+			}
+		})
+	}
+}
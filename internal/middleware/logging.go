@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/metrics"
+	"github/com/ammar-nousher-ali/students-api/internal/utils"
+	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"runtime/debug"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// incoming request ids longer than this are replaced
+const maxRequestIDLength = 128
+
+// RequestID takes the request id from the X-Request-ID header, or assigns a new one, and
+// echoes it in the response. The id is available through utils.RequestInfoFromContext.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		next.ServeHTTP(w, r.WithContext(utils.WithRequestInfo(r.Context(), &utils.RequestInfo{ID: id})))
+	})
+}
+
+// RealIP resolves the client address of the request once, following X-Forwarded-For through
+// the trusted proxies, for utils.ClientIP. Put it inside RequestID.
+func RealIP(proxies []netip.Prefix, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := utils.RequestInfoFromContext(r.Context()); ok {
+			info.ClientIP = utils.ResolveClientIP(r, proxies)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Logger writes one access log record per request. Put it inside RealIP, with nothing that
+// replaces the request between it and the ServeMux, or the route is lost.
+func Logger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", route(r)),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.Status()),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int("bytes", sw.bytes),
+			slog.String("remote_ip", utils.ClientIP(r)),
+		}
+
+		if info, ok := utils.RequestInfoFromContext(r.Context()); ok && info.UserID != 0 {
+			attrs = append(attrs, slog.Int64("user_id", info.UserID))
+		}
+
+		level := slog.LevelInfo
+		if sw.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// Recover turns a panic in a handler into a 500 response and logs it with its stack.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		sw := &statusWriter{ResponseWriter: w}
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			//the server uses this panic to abort a response on purpose
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			slog.ErrorContext(r.Context(), "handler panicked",
+				slog.Any("panic", recovered),
+				slog.String("stack", string(debug.Stack())),
+			)
+
+			//too late to change a response that has started
+			if sw.status != 0 {
+				return
+			}
+
+			response.WriteJson(sw, http.StatusInternalServerError, response.GeneralError(fmt.Errorf("internal server error"), http.StatusInternalServerError))
+		}()
+
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// statusWriter records the status and the size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status is the status sent, 200 when the handler wrote nothing.
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// route is the pattern of the route that served the request, set by the ServeMux.
+func route(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+	return r.Pattern
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	//the id ends up in logs and headers, keep it to visible ascii
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Metrics records the count and latency of every request by its route pattern.
+func Metrics(m *metrics.Metrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+
+		m.ObserveRequest(r.Method, route(r), sw.Status(), time.Since(start))
+	})
+}
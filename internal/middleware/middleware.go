@@ -2,43 +2,91 @@ package middleware
 
 import (
 	"fmt"
-	"github/com/ammar-nousher-ali/students-api/internal/http/handlers/auth"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/token"
+	"github/com/ammar-nousher-ali/students-api/internal/utils"
 	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
 	"net/http"
+	"slices"
 	"strings"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func JWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// JWTMiddleware authenticates the request with its bearer token and rejects tokens that
+// were revoked by signing out. Rejections carry one of the model.TokenErr codes.
+func JWTMiddleware(storage storage.Storage, keys *token.KeySet, cfg config.JWT, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			err := fmt.Errorf("missing authorization header")
-			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(err, http.StatusUnauthorized))
+		raw, code, err := bearerToken(r)
+		if err != nil {
+			unauthorized(w, err, code)
+			return
+		}
+
+		claims, err := keys.Parse(raw, cfg)
+		if err != nil {
+			unauthorized(w, fmt.Errorf("invalid token: %w", err), token.ErrorCode(err))
+			return
+		}
+
+		principal := claims.Principal()
+
+		revoked, err := storage.IsTokenRevoked(r.Context(), principal.TokenID)
+		if err != nil {
+			response.WriteJson(w, http.StatusInternalServerError, response.GeneralError(err, http.StatusInternalServerError))
+			return
+		}
+
+		if revoked {
+			unauthorized(w, fmt.Errorf("token has been revoked"), model.TokenErrRevoked)
 			return
 		}
-		//slog.Info("token is ", authHeader)
-		parts := strings.Split(authHeader, " ")
-		//slog.Info("parts is ", parts)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			err := fmt.Errorf("invalid authorization header format")
-			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(err, http.StatusUnauthorized))
+
+		//the access log runs outside of this middleware and learns the user from here
+		if info, ok := utils.RequestInfoFromContext(r.Context()); ok {
+			info.UserID = principal.UserID
+		}
+
+		next(w, r.WithContext(utils.WithPrincipal(r.Context(), principal)))
+	}
+}
+
+// bearerToken returns the token of the Authorization header, or the model.TokenErr code of
+// what is wrong with the header.
+func bearerToken(r *http.Request) (string, string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", model.TokenErrMissing, fmt.Errorf("missing authorization header")
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", model.TokenErrMalformed, fmt.Errorf("invalid authorization header format")
+	}
+
+	return parts[1], "", nil
+}
+
+// unauthorized writes a 401 with the bearer challenge of RFC 6750.
+func unauthorized(w http.ResponseWriter, err error, code string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, code))
+	response.WriteJson(w, http.StatusUnauthorized, response.CodedError(err, http.StatusUnauthorized, code))
+}
+
+// RequireRoles lets the request through only when the authenticated principal
+// has one of the given roles. It must be wrapped by JWTMiddleware.
+func RequireRoles(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		principal, ok := utils.PrincipalFromContext(r.Context())
+		if !ok {
+			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("authentication required"), http.StatusUnauthorized))
 			return
 		}
 
-		tokenStr := parts[1]
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (any, error) {
-			_, ok := token.Method.(*jwt.SigningMethodHMAC) //This is type assertion. it means I expect token.Method to be of type *jwt.SigningMethodHMAC. Try to cast it to that type.
-			if !ok {
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return auth.JwtSecret, nil
-		})
-
-		if err != nil || !token.Valid {
-			response.WriteJson(w, http.StatusUnauthorized, response.GeneralError(fmt.Errorf("invalid or expired token"), http.StatusUnauthorized))
+		if !slices.Contains(roles, principal.Role) {
+			response.WriteJson(w, http.StatusForbidden, response.GeneralError(fmt.Errorf("role %s is not allowed to access this resource", principal.Role), http.StatusForbidden))
 			return
 		}
 
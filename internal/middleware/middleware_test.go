@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/token"
+	"github/com/ammar-nousher-ali/students-api/internal/utils"
+	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// revokedTokens is a storage that only knows which tokens were revoked.
+type revokedTokens struct {
+	storage.Storage
+	jtis map[string]bool
+}
+
+func (s revokedTokens) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return s.jtis[jti], nil
+}
+
+func testKeys(t *testing.T) (*token.KeySet, config.JWT) {
+	t.Helper()
+
+	cfg := config.JWT{
+		Issuer:     "students-api",
+		Audience:   "students-api",
+		SigningKey: "default",
+		Keys:       []config.JWTKey{{Kid: "default", Algorithm: token.AlgHS256, Secret: "0123456789abcdef0123456789abcdef"}},
+	}
+
+	keys, err := token.NewKeySet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys, cfg
+}
+
+// signToken returns an access token of a teacher with the user id and jti.
+func signToken(t *testing.T, keys *token.KeySet, cfg config.JWT, userId int64, jti string, expiresAt time.Time) string {
+	t.Helper()
+
+	signed, err := keys.Sign(&token.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    cfg.Issuer,
+			Audience:  jwt.ClaimStrings{cfg.Audience},
+			Subject:   strconv.FormatInt(userId, 10),
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Role: model.RoleTeacher,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	keys, cfg := testKeys(t)
+
+	now := time.Now()
+	sign := func(jti string, expiresAt time.Time) string {
+		return signToken(t, keys, cfg, 7, jti, expiresAt)
+	}
+
+	store := revokedTokens{jtis: map[string]bool{"signed-out": true}}
+
+	tests := []struct {
+		name   string
+		header string
+		code   string // empty when the request goes through
+	}{
+		{"valid", "Bearer " + sign("active", now.Add(time.Minute)), ""},
+		{"no header", "", model.TokenErrMissing},
+		{"not a bearer token", "Basic dXNlcjpwYXNz", model.TokenErrMalformed},
+		{"malformed", "Bearer not.a.token", model.TokenErrMalformed},
+		{"expired", "Bearer " + sign("active", now.Add(-time.Minute)), model.TokenErrExpired},
+		{"revoked", "Bearer " + sign("signed-out", now.Add(time.Minute)), model.TokenErrRevoked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var principal model.Principal
+			handler := JWTMiddleware(store, keys, cfg, func(w http.ResponseWriter, r *http.Request) {
+				principal, _ = utils.PrincipalFromContext(r.Context())
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if tt.code == "" {
+				if w.Code != http.StatusNoContent || principal.UserID != 7 || principal.Role != model.RoleTeacher {
+					t.Errorf("got %d with principal %+v", w.Code, principal)
+				}
+				return
+			}
+
+			var res response.Response
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != http.StatusUnauthorized || res.Code != tt.code {
+				t.Errorf("got %d %s, want 401 %s", w.Code, res.Code, tt.code)
+			}
+			if w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("no WWW-Authenticate challenge")
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/token"
+	"github/com/ammar-nousher-ali/students-api/internal/utils"
+	"github/com/ammar-nousher-ali/students-api/internal/utils/response"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// buckets that are full again are dropped this often
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // when the bucket is refilled completely
+}
+
+// RateLimiter keeps the token buckets of every client in memory, limits are per process.
+type RateLimiter struct {
+	cfg       config.RateLimits
+	keys      *token.KeySet
+	jwt       config.JWT
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time // the clock, replaced in tests
+}
+
+// NewRateLimiter returns a limiter that tells signed in users apart by the access tokens
+// keys verify.
+func NewRateLimiter(cfg config.RateLimits, keys *token.KeySet, jwt config.JWT) *RateLimiter {
+	return &RateLimiter{cfg: cfg, keys: keys, jwt: jwt, buckets: map[string]*bucket{}, lastSweep: time.Now(), now: time.Now}
+}
+
+// Limit rate limits next with the buckets of group. Put it in front of JWTMiddleware, so
+// requests with a missing or invalid token are limited too, by address. Requests with a
+// valid access token are limited by user id.
+func (l *RateLimiter) Limit(group string, next http.HandlerFunc) http.HandlerFunc {
+	if !l.cfg.Enabled {
+		return next
+	}
+
+	limit, ok := l.cfg.Groups[group]
+	if !ok {
+		limit = l.cfg.Default
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		client := l.client(r)
+
+		allowed, remaining, retryAfter, reset := l.take(group+"|"+client, limit, l.now())
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(reset)))
+
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds(retryAfter)))
+			response.WriteJson(w, http.StatusTooManyRequests, response.CodedError(fmt.Errorf("rate limit exceeded, try again later"), http.StatusTooManyRequests, model.ErrCodeRateLimited))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// client returns the bucket owner of the request, the user of a verified access token or
+// else the client address. Revocation is left to JWTMiddleware, a revoked token still names
+// the user it was issued to.
+func (l *RateLimiter) client(r *http.Request) string {
+	if raw, _, err := bearerToken(r); err == nil {
+		if claims, err := l.keys.Parse(raw, l.jwt); err == nil {
+			return fmt.Sprintf("user:%d", claims.Principal().UserID)
+		}
+	}
+
+	return "ip:" + utils.ClientIP(r)
+}
+
+// take refills the bucket of key and takes a token from it when there is one. It returns
+// the whole tokens left, the wait until the next token and the wait until the bucket is
+// full again.
+func (l *RateLimiter) take(key string, limit config.RateLimit, now time.Time) (bool, int, time.Duration, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	burst := float64(limit.Burst)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	retryAfter := time.Duration(0)
+	if b.tokens < 1 {
+		retryAfter = rateDuration(1-b.tokens, limit.Rate)
+	}
+
+	reset := rateDuration(burst-b.tokens, limit.Rate)
+	b.full = now.Add(reset)
+
+	return allowed, int(b.tokens), retryAfter, reset
+}
+
+// sweep drops the buckets that refilled completely, they are the same as a new bucket.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func rateDuration(tokens float64, rate float64) time.Duration {
+	return time.Duration(tokens / rate * float64(time.Second))
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
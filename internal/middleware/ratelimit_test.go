@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestLimiter(t *testing.T, cfg config.RateLimits) (*RateLimiter, *fakeClock) {
+	t.Helper()
+
+	keys, jwt := testKeys(t)
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	limiter := NewRateLimiter(cfg, keys, jwt)
+	limiter.now = clock.Now
+	limiter.lastSweep = clock.now
+
+	return limiter, clock
+}
+
+// limitedRequest sends a request from addr with the optional bearer token through handler.
+func limitedRequest(handler http.HandlerFunc, addr string, bearer string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/api/students", nil)
+	r.RemoteAddr = addr + ":40000"
+	if bearer != "" {
+		r.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	return w
+}
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	//one token every two seconds, two at most
+	limiter, clock := newTestLimiter(t, config.RateLimits{Enabled: true, Default: config.RateLimit{Rate: 0.5, Burst: 2}})
+	handler := limiter.Limit("api", ok)
+
+	steps := []struct {
+		name       string
+		advance    time.Duration
+		status     int
+		remaining  string
+		retryAfter string // empty when the request is allowed
+		reset      string
+	}{
+		{"full bucket", 0, http.StatusOK, "1", "", "2"},
+		{"last token", 0, http.StatusOK, "0", "", "4"},
+		{"empty bucket", 0, http.StatusTooManyRequests, "0", "2", "4"},
+		{"partly refilled", 1500 * time.Millisecond, http.StatusTooManyRequests, "0", "1", "3"},
+		{"refilled token", 500 * time.Millisecond, http.StatusOK, "0", "", "4"},
+		{"refill stops at the burst", time.Hour, http.StatusOK, "1", "", "2"},
+	}
+
+	for _, step := range steps {
+		clock.now = clock.now.Add(step.advance)
+		w := limitedRequest(handler, "192.0.2.1", "")
+
+		if w.Code != step.status {
+			t.Errorf("%s: got %d, want %d", step.name, w.Code, step.status)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != step.remaining {
+			t.Errorf("%s: RateLimit-Remaining %s, want %s", step.name, got, step.remaining)
+		}
+		if got := w.Header().Get("Retry-After"); got != step.retryAfter {
+			t.Errorf("%s: Retry-After %q, want %q", step.name, got, step.retryAfter)
+		}
+		if got := w.Header().Get("RateLimit-Reset"); got != step.reset {
+			t.Errorf("%s: RateLimit-Reset %s, want %s", step.name, got, step.reset)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("%s: RateLimit-Limit %s, want 2", step.name, got)
+		}
+	}
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	limiter, _ := newTestLimiter(t, config.RateLimits{
+		Enabled: true,
+		Default: config.RateLimit{Rate: 1, Burst: 1},
+		Groups:  map[string]config.RateLimit{"auth": {Rate: 1, Burst: 1}},
+	})
+	auth, api := limiter.Limit("auth", ok), limiter.Limit("api", ok)
+
+	keys, jwt := testKeys(t)
+	expires := time.Now().Add(time.Hour)
+	first, second := signToken(t, keys, jwt, 1, "first", expires), signToken(t, keys, jwt, 2, "second", expires)
+
+	//the buckets of 192.0.2.1 in the auth group and of the first user are empty after this
+	limitedRequest(auth, "192.0.2.1", "")
+	limitedRequest(api, "192.0.2.9", first)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		addr    string
+		bearer  string
+		status  int
+	}{
+		{"same address and group", auth, "192.0.2.1", "", http.StatusTooManyRequests},
+		{"same address in another group", api, "192.0.2.1", "", http.StatusOK},
+		{"another address", auth, "192.0.2.2", "", http.StatusOK},
+		{"same user from another address", api, "192.0.2.10", first, http.StatusTooManyRequests},
+		{"same user in another group", auth, "192.0.2.9", first, http.StatusOK},
+		{"another user from the same address", api, "192.0.2.9", second, http.StatusOK},
+		{"invalid token falls back to the address", auth, "192.0.2.1", "not.a.token", http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := limitedRequest(tt.handler, tt.addr, tt.bearer); w.Code != tt.status {
+				t.Errorf("got %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	limiter, _ := newTestLimiter(t, config.RateLimits{Default: config.RateLimit{Rate: 1, Burst: 1}})
+	handler := limiter.Limit("api", ok)
+
+	for i := range 3 {
+		if w := limitedRequest(handler, "192.0.2.1", ""); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Errorf("request %d: got %d with %v", i+1, w.Code, w.Header())
+		}
+	}
+}
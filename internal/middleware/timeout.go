@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Timeout cancels the context of every request after d. The storage calls of a handler fail
+// once it is cancelled, just like they do when the client goes away. Put it outside Logger
+// and Metrics, the request it passes on is a copy and they have to see the one the ServeMux
+// sets the route pattern on.
+func Timeout(d time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
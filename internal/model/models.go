@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 type Student struct {
 	Id             int64      `json:"id"`
@@ -13,6 +17,7 @@ type Student struct {
 	EnrollmentDate time.Time  `json:"enrollment_date,omitempty"`
 	Status         string     `json:"status,omitempty"`
 	DeleteAt       *time.Time `json:"delete_at,omitempty"`
+	UserId         *int64     `json:"user_id,omitempty"` // the student account of this student, if any
 }
 
 type StudentUpdateRequest struct {
@@ -31,6 +36,7 @@ type StudentUpdateRequest struct {
 	Gender         *string    `json:"gender"`
 	EnrollmentDate *time.Time `json:"enrollment_date"`
 	Status         *string    `json:"status"`
+	UserId         *int64     `json:"user_id"` // 0 unlinks the user account
 }
 
 type CourseUpdateRequest struct {
@@ -47,13 +53,115 @@ type CourseUpdateRequest struct {
 	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
 }
 
+const (
+	RoleStudent = "student"
+	RoleTeacher = "teacher"
+	RoleAdmin   = "admin"
+)
+
 type User struct {
-	ID       int64  `json:"id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password,omitempty"`
-	Role     string `json:"role"`
+	ID              int64      `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Password        string     `json:"password,omitempty"`
+	Role            string     `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+}
+
+const (
+	LoginScopeAccount = "account"
+	LoginScopeIP      = "ip"
+)
+
+// LoginFailures counts the recent failed sign in attempts of an account (by email) or of a
+// client address.
+type LoginFailures struct {
+	Scope        string    `json:"scope"`
+	Subject      string    `json:"subject"`
+	Failures     int       `json:"failures"`
+	LastFailedAt time.Time `json:"last_failed_at"`
+}
+
+const (
+	AccountTokenPasswordReset     = "password_reset"
+	AccountTokenEmailVerification = "email_verification"
+)
+
+// AccountToken is a single use, emailed token of the password reset and email
+// verification flows. Only its hash is stored.
+type AccountToken struct {
+	Id        int64
+	UserId    int64
+	Purpose   string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type TokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type PasswordResetRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+const (
+	AuthErrEmailNotVerified = "email_not_verified"
+	AuthErrTooManyAttempts  = "too_many_attempts"
+)
+
+const ErrCodeRateLimited = "rate_limited"
+
+// Principal is the authenticated caller, built from the JWT claims.
+type Principal struct {
+	UserID int64  `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+
+	//the access token the request was made with, used to sign it out
+	TokenID   string    `json:"-"`
+	SessionID string    `json:"-"`
+	ExpiresAt time.Time `json:"-"`
+}
+
+// machine readable codes of a rejected access token, sent in Response.Code with the 401
+const (
+	TokenErrMissing      = "token_missing"
+	TokenErrMalformed    = "token_malformed"
+	TokenErrSignature    = "token_signature_invalid"
+	TokenErrExpired      = "token_expired"
+	TokenErrNotYetValid  = "token_not_yet_valid"
+	TokenErrInvalidClaim = "token_claims_invalid"
+	TokenErrRevoked      = "token_revoked"
+)
+
+// RefreshToken is the server side record of an issued refresh token. Only the hash of the
+// token is stored. Every token issued by rotating another one shares its FamilyId, which
+// identifies the sign in session.
+type RefreshToken struct {
+	Id              int64      `json:"id"`
+	UserId          int64      `json:"user_id"`
+	TokenHash       string     `json:"-"`
+	FamilyId        string     `json:"family_id"`
+	AccessJti       string     `json:"-"` // the access token issued together with this one
+	AccessExpiresAt time.Time  `json:"-"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	UsedAt          *time.Time `json:"used_at,omitempty"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
 }
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
 type Creds struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
@@ -77,23 +185,285 @@ type Course struct {
 }
 
 type EnrollRequest struct {
-	Courses []int64 `json:"courses"`
+	Courses []int64 `json:"courses" validate:"required,min=1,dive,gt=0"`
 }
 
 type EnrollmentResponse struct {
 	StudentId       int64            `json:"student_id"`
 	EnrolledCourses []int64          `json:"enrolled_courses,omitempty"`
+	Waitlisted      []WaitlistEntry  `json:"waitlisted,omitempty"` // full courses the student was queued for
 	FailedCourses   []EnrollmentFail `json:"failed_courses,omitempty"`
 }
 
+// machine readable codes of a rejected enrollment, see EnrollmentFail.Code
+const (
+	EnrollErrStudentNotFound = "student_not_found"
+	EnrollErrCourseNotFound  = "course_not_found"
+	EnrollErrCourseInactive  = "course_inactive"
+	EnrollErrCourseFull      = "course_full"
+	EnrollErrAlreadyEnrolled = "already_enrolled"
+	EnrollErrWaitlisted      = "already_waitlisted"
+	EnrollErrNotEnrolled     = "not_enrolled"
+	EnrollErrPrerequisites   = "prerequisites_not_met"
+	EnrollErrInternal        = "internal_error"
+)
+
 type EnrollmentFail struct {
-	CourseID int64  `json:"course_id"`
-	Error    string `json:"error"`
+	CourseID           int64          `json:"course_id"`
+	Code               string         `json:"code"`
+	Error              string         `json:"error"`
+	UnmetPrerequisites []Prerequisite `json:"unmet_prerequisites,omitempty"`
 }
 
 type StudentWithCoursesResponse struct {
-	StudentID    int64    `json:"student_id"`
-	StudentName  string   `json:"student_name"`
-	StudentEmail string   `json:"student_email"`
-	Courses      []Course `json:"courses"`
+	StudentID      int64           `json:"student_id"`
+	StudentName    string          `json:"student_name"`
+	StudentEmail   string          `json:"student_email"`
+	Courses        []Course        `json:"courses"`
+	DroppedCourses []DroppedCourse `json:"dropped_courses,omitempty"`
+}
+
+// DroppedCourse is a past enrollment the student withdrew from.
+type DroppedCourse struct {
+	Course
+	EnrolledAt time.Time `json:"enrolled_at"`
+	DroppedAt  time.Time `json:"dropped_at"`
+	DropReason string    `json:"drop_reason,omitempty"`
+}
+
+type DropRequest struct {
+	Courses []int64 `json:"courses"`
+	Reason  string  `json:"reason"`
+}
+
+type DropResponse struct {
+	StudentId      int64            `json:"student_id"`
+	DroppedCourses []int64          `json:"dropped_courses,omitempty"`
+	FailedCourses  []EnrollmentFail `json:"failed_courses,omitempty"`
+	Promoted       []WaitlistEntry  `json:"promoted,omitempty"` // waitlisted students who took the freed seats
+}
+
+// ListQuery holds the pagination, sorting and filtering options of a list request.
+type ListQuery struct {
+	Limit   int
+	Offset  int
+	After   *Cursor // last row of the previous page, decoded from the cursor
+	Sort    string
+	Desc    bool
+	Filters map[string]string
+}
+
+// Cursor points at the last row of a page. It is only valid for the sort it was made for,
+// Value is the sort column of that row, nil when the column is NULL.
+type Cursor struct {
+	Sort  string
+	Desc  bool
+	Value any
+	Id    int64
+}
+
+type PageMeta struct {
+	Total      int64  `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// sortable and filterable columns of the list endpoints, named after their json fields
+var (
+	StudentSortFields   = []string{"id", "name", "email", "age", "phone", "address", "gender", "enrollment_date", "status"}
+	StudentFilterFields = []string{"status", "gender"}
+
+	CourseSortFields   = []string{"id", "course_code", "course_name", "credits", "instructor", "department", "semester", "academic_year", "capacity", "status", "created_at", "updated_at"}
+	CourseFilterFields = []string{"status", "department", "semester", "instructor", "academic_year"}
+)
+
+const (
+	WaitlistWaiting  = "waiting"
+	WaitlistPromoted = "promoted"
+	WaitlistRemoved  = "removed" // the student was deleted before a seat freed up
+)
+
+type WaitlistEntry struct {
+	Id         int64      `json:"id"`
+	StudentId  int64      `json:"student_id"`
+	CourseId   int64      `json:"course_id"`
+	Position   int        `json:"position,omitempty"` // 1 based, only set while waiting
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	PromotedAt *time.Time `json:"promoted_at,omitempty"`
+}
+
+type Prerequisite struct {
+	CourseId         int64  `json:"course_id"`
+	PrerequisiteId   int64  `json:"prerequisite_id" validate:"required"`
+	PrerequisiteCode string `json:"prerequisite_code,omitempty"`
+	PrerequisiteName string `json:"prerequisite_name,omitempty"`
+	MinGrade         string `json:"min_grade,omitempty"` // empty when any passing grade is enough
+}
+
+var (
+	ErrInvalidPrerequisite = errors.New("a course can not require itself, directly or through other prerequisites")
+	ErrInvalidGrade        = errors.New("unknown grade")
+	ErrTokenReused         = errors.New("refresh token was already used")
+	ErrInvalidUserLink     = errors.New("invalid user link")
+	ErrDuplicate           = errors.New("already exists") // a unique value, like an email or a course code, is taken
+	ErrCourseHasHistory    = errors.New("course has enrollments or attendance, set it inactive instead")
+)
+
+// Batch modes. A partial batch creates every valid item on its own, an atomic batch creates
+// all items or none of them.
+const (
+	BatchModePartial = "partial"
+	BatchModeAtomic  = "atomic"
+)
+
+// BatchError is returned by the atomic batch methods of the storage with the position of the
+// item that failed, the whole batch was rolled back.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("item %d: %s", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// GradeRequest records the outcome of an enrollment. When only a score is given the letter
+// is looked up on the grade scale.
+type GradeRequest struct {
+	LetterGrade *string  `json:"letter_grade"`
+	Score       *float64 `json:"score" validate:"omitempty,min=0,max=100"`
+}
+
+// CourseGrade is a graded enrollment together with the course details GPA and transcripts need.
+type CourseGrade struct {
+	CourseId     int64      `json:"course_id"`
+	CourseCode   string     `json:"course_code"`
+	CourseName   string     `json:"course_name"`
+	Credits      int        `json:"credits"`
+	AcademicYear string     `json:"academic_year"`
+	Semester     string     `json:"semester"`
+	LetterGrade  string     `json:"letter_grade"`
+	Score        *float64   `json:"score,omitempty"`
+	GradePoints  float64    `json:"grade_points"`
+	GradedBy     int64      `json:"graded_by,omitempty"`
+	GradedAt     *time.Time `json:"graded_at,omitempty"`
+}
+
+type TermGPA struct {
+	AcademicYear string  `json:"academic_year"`
+	Semester     string  `json:"semester"`
+	Credits      int     `json:"credits"`
+	GPA          float64 `json:"gpa"`
+}
+
+type GPAReport struct {
+	StudentId     int64         `json:"student_id"`
+	CumulativeGPA float64       `json:"cumulative_gpa"`
+	TotalCredits  int           `json:"total_credits"`
+	Terms         []TermGPA     `json:"terms"`
+	Courses       []CourseGrade `json:"courses"`
+}
+
+type TranscriptTerm struct {
+	TermGPA
+	Courses []CourseGrade `json:"courses"`
+}
+
+// Transcript is an issued copy of the academic record of a student. VerificationHash is
+// computed over every other field, so any change to a printed copy shows up when it is
+// checked against the stored one.
+type Transcript struct {
+	StudentId        int64            `json:"student_id"`
+	StudentName      string           `json:"student_name"`
+	StudentEmail     string           `json:"student_email"`
+	EnrollmentDate   time.Time        `json:"enrollment_date"`
+	Terms            []TranscriptTerm `json:"terms"`
+	TotalCredits     int              `json:"total_credits"`
+	CumulativeGPA    float64          `json:"cumulative_gpa"`
+	IssuedAt         time.Time        `json:"issued_at"`
+	IssuedBy         int64            `json:"issued_by,omitempty"`
+	VerificationHash string           `json:"verification_hash,omitempty"`
+}
+
+// CourseSession is a single class meeting of a course, dates are YYYY-MM-DD and times HH:MM.
+type CourseSession struct {
+	Id        int64     `json:"id"`
+	CourseId  int64     `json:"course_id"`
+	Date      string    `json:"date" validate:"required,datetime=2006-01-02"`
+	StartTime string    `json:"start_time" validate:"required,datetime=15:04"`
+	EndTime   string    `json:"end_time" validate:"required,datetime=15:04"`
+	Room      string    `json:"room,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	AttendancePresent = "present"
+	AttendanceAbsent  = "absent"
+	AttendanceLate    = "late"
+	AttendanceExcused = "excused"
+)
+
+type AttendanceMark struct {
+	StudentId int64  `json:"student_id" validate:"required"`
+	Status    string `json:"status" validate:"required,oneof=present absent late excused"`
+	Note      string `json:"note,omitempty"`
+}
+
+// AttendanceRequest marks a session. Status, when set, is applied to every enrolled student
+// that is not listed in Records, so a whole session can be marked in one call.
+type AttendanceRequest struct {
+	Status  string           `json:"status,omitempty" validate:"omitempty,oneof=present absent late excused"`
+	Records []AttendanceMark `json:"records" validate:"dive"`
+}
+
+type AttendanceRecord struct {
+	SessionId   int64     `json:"session_id"`
+	StudentId   int64     `json:"student_id"`
+	StudentName string    `json:"student_name,omitempty"`
+	Status      string    `json:"status"`
+	Note        string    `json:"note,omitempty"`
+	MarkedBy    int64     `json:"marked_by,omitempty"`
+	MarkedAt    time.Time `json:"marked_at"`
+}
+
+type AttendanceFail struct {
+	StudentId int64  `json:"student_id"`
+	Code      string `json:"code"` // one of the EnrollErr codes
+	Error     string `json:"error"`
+}
+
+type AttendanceResponse struct {
+	SessionId int64              `json:"session_id"`
+	Marked    []AttendanceRecord `json:"marked,omitempty"`
+	Failed    []AttendanceFail   `json:"failed,omitempty"`
+}
+
+// AttendanceSummary is the attendance of one student in one course. Percentage counts late
+// as attended and leaves excused and unmarked sessions out.
+type AttendanceSummary struct {
+	StudentId   int64   `json:"student_id"`
+	StudentName string  `json:"student_name,omitempty"`
+	CourseId    int64   `json:"course_id"`
+	CourseCode  string  `json:"course_code,omitempty"`
+	Sessions    int     `json:"sessions"`
+	Present     int     `json:"present"`
+	Late        int     `json:"late"`
+	Absent      int     `json:"absent"`
+	Excused     int     `json:"excused"`
+	Unmarked    int     `json:"unmarked"`
+	Percentage  float64 `json:"percentage"`
+}
+
+// Stats are the current totals reported by the business metrics.
+type Stats struct {
+	ActiveStudents    int64
+	Courses           int64
+	ActiveEnrollments int64
+	Waitlisted        int64
 }
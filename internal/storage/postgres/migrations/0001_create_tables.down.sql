@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS student_courses;
+DROP TABLE IF EXISTS courses;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS students;
@@ -0,0 +1,44 @@
+-- IF NOT EXISTS lets databases created before migrations were introduced adopt this version.
+CREATE TABLE IF NOT EXISTS students(
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT,
+	email TEXT,
+	age INTEGER,
+	phone TEXT,
+	address TEXT,
+	gender TEXT,
+	enrollment_date TIMESTAMPTZ,
+	status TEXT,
+	deleted_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS users(
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL CHECK (role IN ('student', 'teacher', 'admin'))
+);
+
+CREATE TABLE IF NOT EXISTS courses(
+	id BIGSERIAL PRIMARY KEY,
+	course_code TEXT NOT NULL UNIQUE,
+	course_name TEXT NOT NULL UNIQUE,
+	description TEXT,
+	credits INTEGER NOT NULL,
+	instructor TEXT,
+	department TEXT,
+	semester TEXT,
+	academic_year TEXT,
+	capacity INTEGER,
+	status TEXT,
+	created_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS student_courses(
+	student_id BIGINT REFERENCES students(id),
+	course_id BIGINT REFERENCES courses(id) ON DELETE CASCADE,
+	enrolled_at TIMESTAMPTZ,
+	PRIMARY KEY (student_id, course_id)
+);
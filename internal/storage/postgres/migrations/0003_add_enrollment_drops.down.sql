@@ -0,0 +1,10 @@
+-- dropped enrollments can not be represented in the old table and are discarded
+DELETE FROM student_courses WHERE dropped_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_student_courses_course;
+DROP INDEX IF EXISTS idx_student_courses_active;
+
+ALTER TABLE student_courses DROP COLUMN drop_reason;
+ALTER TABLE student_courses DROP COLUMN dropped_at;
+ALTER TABLE student_courses DROP COLUMN id;
+ALTER TABLE student_courses ADD PRIMARY KEY (student_id, course_id);
@@ -0,0 +1,8 @@
+-- enrollments get their own id so a dropped enrollment can be kept next to a later re-enrollment
+ALTER TABLE student_courses DROP CONSTRAINT student_courses_pkey;
+ALTER TABLE student_courses ADD COLUMN id BIGSERIAL PRIMARY KEY;
+ALTER TABLE student_courses ADD COLUMN dropped_at TIMESTAMPTZ;
+ALTER TABLE student_courses ADD COLUMN drop_reason TEXT;
+
+CREATE UNIQUE INDEX idx_student_courses_active ON student_courses(student_id, course_id) WHERE dropped_at IS NULL;
+CREATE INDEX idx_student_courses_course ON student_courses(course_id);
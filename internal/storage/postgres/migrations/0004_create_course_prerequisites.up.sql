@@ -0,0 +1,11 @@
+CREATE TABLE course_prerequisites(
+	course_id BIGINT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+	prerequisite_id BIGINT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+	min_grade TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (course_id, prerequisite_id)
+);
+
+-- a prerequisite counts once the enrollment is completed, with a grade when a minimum is required
+ALTER TABLE student_courses ADD COLUMN grade TEXT;
+ALTER TABLE student_courses ADD COLUMN completed_at TIMESTAMPTZ;
@@ -0,0 +1,5 @@
+-- grade (the letter) and completed_at were added with the prerequisites
+ALTER TABLE student_courses ADD COLUMN score DOUBLE PRECISION;
+ALTER TABLE student_courses ADD COLUMN grade_points DOUBLE PRECISION;
+ALTER TABLE student_courses ADD COLUMN graded_by BIGINT;
+ALTER TABLE student_courses ADD COLUMN graded_at TIMESTAMPTZ;
@@ -0,0 +1,25 @@
+CREATE TABLE course_sessions(
+	id BIGSERIAL PRIMARY KEY,
+	course_id BIGINT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+	session_date TEXT NOT NULL,
+	start_time TEXT NOT NULL,
+	end_time TEXT NOT NULL,
+	room TEXT,
+	created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_course_sessions_course ON course_sessions(course_id, session_date, start_time);
+
+-- one mark per student and session, marking again overwrites it
+CREATE TABLE attendance(
+	id BIGSERIAL PRIMARY KEY,
+	session_id BIGINT NOT NULL REFERENCES course_sessions(id) ON DELETE CASCADE,
+	student_id BIGINT NOT NULL,
+	status TEXT NOT NULL CHECK (status IN ('present', 'absent', 'late', 'excused')),
+	note TEXT,
+	marked_by BIGINT,
+	marked_at TIMESTAMPTZ NOT NULL,
+	UNIQUE (session_id, student_id)
+);
+
+CREATE INDEX idx_attendance_student ON attendance(student_id);
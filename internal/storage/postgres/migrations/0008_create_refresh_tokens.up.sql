@@ -0,0 +1,24 @@
+-- refresh tokens are stored hashed, a family is one sign in session
+CREATE TABLE refresh_tokens(
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	family_id TEXT NOT NULL,
+	access_jti TEXT NOT NULL,
+	access_expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX idx_refresh_tokens_user ON refresh_tokens(user_id);
+
+-- access tokens signed out before they expire, rows can go once expires_at has passed
+CREATE TABLE revoked_tokens(
+	jti TEXT PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- single use tokens of the password reset and email verification flows, stored hashed
+CREATE TABLE account_tokens(
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	purpose TEXT NOT NULL CHECK (purpose IN ('password_reset', 'email_verification')),
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_account_tokens_user ON account_tokens(user_id, purpose);
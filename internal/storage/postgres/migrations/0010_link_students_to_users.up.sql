@@ -0,0 +1,4 @@
+-- the student account that signs in for this student record
+ALTER TABLE students ADD COLUMN user_id BIGINT;
+
+CREATE UNIQUE INDEX idx_students_user ON students(user_id) WHERE user_id IS NOT NULL AND deleted_at IS NULL;
@@ -0,0 +1,8 @@
+-- recent failed sign in attempts per account (email) and per client address
+CREATE TABLE login_failures(
+	scope TEXT NOT NULL CHECK (scope IN ('account', 'ip')),
+	subject TEXT NOT NULL,
+	failures INTEGER NOT NULL,
+	last_failed_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (scope, subject)
+);
@@ -0,0 +1 @@
+ALTER TABLE course_waitlist DROP CONSTRAINT course_waitlist_course_id_fkey;
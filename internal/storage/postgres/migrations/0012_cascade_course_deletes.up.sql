@@ -0,0 +1,4 @@
+-- waitlist entries go with their course like enrollments, prerequisites and sessions already do
+DELETE FROM course_waitlist WHERE course_id NOT IN (SELECT id FROM courses);
+
+ALTER TABLE course_waitlist ADD CONSTRAINT course_waitlist_course_id_fkey FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE;
@@ -0,0 +1 @@
+-- nothing to undo, the check is the one 0001 creates
@@ -0,0 +1,4 @@
+-- keeps the version numbers of both backends in step, 0001 always created this check on postgres
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('student', 'teacher', 'admin'));
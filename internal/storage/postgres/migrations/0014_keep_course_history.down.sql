@@ -0,0 +1,5 @@
+ALTER TABLE attendance DROP CONSTRAINT attendance_session_id_fkey;
+ALTER TABLE attendance ADD CONSTRAINT attendance_session_id_fkey FOREIGN KEY (session_id) REFERENCES course_sessions(id) ON DELETE CASCADE;
+
+ALTER TABLE student_courses DROP CONSTRAINT student_courses_course_id_fkey;
+ALTER TABLE student_courses ADD CONSTRAINT student_courses_course_id_fkey FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE;
@@ -0,0 +1,7 @@
+-- enrollments, with their grades and drops, and attendance are history, deleting a course must
+-- not take them along. The storage refuses to delete a course that has any, these keys back it up.
+ALTER TABLE student_courses DROP CONSTRAINT student_courses_course_id_fkey;
+ALTER TABLE student_courses ADD CONSTRAINT student_courses_course_id_fkey FOREIGN KEY (course_id) REFERENCES courses(id);
+
+ALTER TABLE attendance DROP CONSTRAINT attendance_session_id_fkey;
+ALTER TABLE attendance ADD CONSTRAINT attendance_session_id_fkey FOREIGN KEY (session_id) REFERENCES course_sessions(id);
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage/migrate"
+	"github/com/ammar-nousher-ali/students-api/internal/storage/sqlstore"
+	"github/com/ammar-nousher-ali/students-api/internal/tracing"
+	"io/fs"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib" //registers the "pgx" driver for database/sql
+)
+
+// uniqueViolation is the postgres error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// dialect numbers the placeholders, returns the ids of inserts and locks rows, transactions
+// run concurrently on postgres.
+var dialect = sqlstore.Dialect{
+	Numbered:  true,
+	Returning: true,
+	RowLocks:  true,
+	//ILIKE keeps the searches case insensitive like sqlite's LIKE
+	Like:         "ILIKE",
+	Timestamp:    "?::timestamptz",
+	TranslateErr: translateErr,
+}
+
+type Postgres struct {
+	*sqlstore.Store
+}
+
+func New(cfg *config.Config) (*Postgres, error) {
+
+	db, err := tracing.OpenDB("pgx", cfg.DatabaseURL, tracing.SystemPostgreSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	return &Postgres{
+		Store: sqlstore.New(db, dialect, cfg.GradeScale),
+	}, nil
+
+}
+
+// translateErr reports unique violations as model.ErrDuplicate, the handlers answer them
+// with a conflict.
+func translateErr(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return fmt.Errorf("%w: %s", model.ErrDuplicate, pgErr.ConstraintName)
+	}
+
+	return err
+}
+
+// Migrator returns the schema migrations of this backend, bound to its database.
+func (p *Postgres) Migrator() (*migrate.Migrator, error) {
+	files, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(p.Db, migrate.Postgres, files)
+}
@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/grading"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/storage/storagetest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+// the suite needs a server, it runs when STUDENTS_API_TEST_DATABASE_URL points at a database
+// the test user may create schemas in. Every subtest gets a schema of its own.
+func TestStorage(t *testing.T) {
+	databaseURL := os.Getenv("STUDENTS_API_TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("STUDENTS_API_TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("pgx", databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		schema := fmt.Sprintf("storagetest_%d", time.Now().UnixNano())
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+		u, err := url.Parse(databaseURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params := u.Query()
+		params.Set("search_path", schema)
+		u.RawQuery = params.Encode()
+
+		p, err := New(&config.Config{DatabaseURL: u.String(), GradeScale: grading.DefaultScale})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { p.Db.Close() })
+
+		migrator, err := p.Migrator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		return p
+	})
+}
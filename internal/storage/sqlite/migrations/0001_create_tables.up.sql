@@ -0,0 +1,46 @@
+-- IF NOT EXISTS lets databases created before migrations were introduced adopt this version.
+CREATE TABLE IF NOT EXISTS students(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT,
+	email TEXT,
+	age INTEGER,
+	phone TEXT,
+	address TEXT,
+	gender TEXT,
+	enrollment_date TIMESTAMP,
+	status TEXT,
+	deleted_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS users(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL CHECK (role IN ('student', 'teacher', 'admin'))
+);
+
+CREATE TABLE IF NOT EXISTS courses(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	course_code TEXT NOT NULL UNIQUE,
+	course_name TEXT NOT NULL UNIQUE,
+	description TEXT,
+	credits INTEGER NOT NULL,
+	instructor TEXT,
+	department TEXT,
+	semester TEXT,
+	academic_year TEXT,
+	capacity INTEGER,
+	status TEXT,
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS student_courses(
+	student_id INTEGER,
+	course_id INTEGER,
+	enrolled_at TIMESTAMP,
+	PRIMARY KEY (student_id, course_id),
+	FOREIGN KEY (student_id) REFERENCES students(id),
+	FOREIGN KEY (course_id) REFERENCES courses(id)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE course_waitlist(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL,
+	status TEXT NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'promoted', 'removed')),
+	created_at TIMESTAMP NOT NULL,
+	promoted_at TIMESTAMP
+);
+
+-- a student can only wait once per course, the id orders the queue
+CREATE UNIQUE INDEX idx_course_waitlist_waiting ON course_waitlist(student_id, course_id) WHERE status = 'waiting';
+CREATE INDEX idx_course_waitlist_course ON course_waitlist(course_id, status, id);
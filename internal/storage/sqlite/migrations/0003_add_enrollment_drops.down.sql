@@ -0,0 +1,16 @@
+-- dropped enrollments can not be represented in the old table and are discarded
+CREATE TABLE student_courses_old(
+	student_id INTEGER,
+	course_id INTEGER,
+	enrolled_at TIMESTAMP,
+	PRIMARY KEY (student_id, course_id),
+	FOREIGN KEY (student_id) REFERENCES students(id),
+	FOREIGN KEY (course_id) REFERENCES courses(id)
+);
+
+INSERT INTO student_courses_old (student_id, course_id, enrolled_at)
+SELECT student_id, course_id, enrolled_at FROM student_courses WHERE dropped_at IS NULL;
+
+DROP TABLE student_courses;
+
+ALTER TABLE student_courses_old RENAME TO student_courses;
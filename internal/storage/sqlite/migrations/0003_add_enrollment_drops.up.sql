@@ -0,0 +1,23 @@
+-- enrollments get their own id so a dropped enrollment can be kept next to a later re-enrollment
+CREATE TABLE student_courses_new(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL,
+	enrolled_at TIMESTAMP,
+	dropped_at TIMESTAMP,
+	drop_reason TEXT,
+	FOREIGN KEY (student_id) REFERENCES students(id),
+	FOREIGN KEY (course_id) REFERENCES courses(id)
+);
+
+-- foreign keys are enforced, the enrollments of courses deleted before this version are not copied
+INSERT INTO student_courses_new (student_id, course_id, enrolled_at)
+SELECT student_id, course_id, enrolled_at FROM student_courses
+WHERE student_id IN (SELECT id FROM students) AND course_id IN (SELECT id FROM courses);
+
+DROP TABLE student_courses;
+
+ALTER TABLE student_courses_new RENAME TO student_courses;
+
+CREATE UNIQUE INDEX idx_student_courses_active ON student_courses(student_id, course_id) WHERE dropped_at IS NULL;
+CREATE INDEX idx_student_courses_course ON student_courses(course_id);
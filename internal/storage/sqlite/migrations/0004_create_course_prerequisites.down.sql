@@ -0,0 +1,4 @@
+ALTER TABLE student_courses DROP COLUMN completed_at;
+ALTER TABLE student_courses DROP COLUMN grade;
+
+DROP TABLE IF EXISTS course_prerequisites;
@@ -0,0 +1,11 @@
+CREATE TABLE course_prerequisites(
+	course_id INTEGER NOT NULL,
+	prerequisite_id INTEGER NOT NULL,
+	min_grade TEXT,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (course_id, prerequisite_id)
+);
+
+-- a prerequisite counts once the enrollment is completed, with a grade when a minimum is required
+ALTER TABLE student_courses ADD COLUMN grade TEXT;
+ALTER TABLE student_courses ADD COLUMN completed_at TIMESTAMP;
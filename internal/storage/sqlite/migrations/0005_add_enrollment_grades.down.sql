@@ -0,0 +1,4 @@
+ALTER TABLE student_courses DROP COLUMN graded_at;
+ALTER TABLE student_courses DROP COLUMN graded_by;
+ALTER TABLE student_courses DROP COLUMN grade_points;
+ALTER TABLE student_courses DROP COLUMN score;
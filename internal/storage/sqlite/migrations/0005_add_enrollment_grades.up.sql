@@ -0,0 +1,5 @@
+-- grade (the letter) and completed_at were added with the prerequisites
+ALTER TABLE student_courses ADD COLUMN score REAL;
+ALTER TABLE student_courses ADD COLUMN grade_points REAL;
+ALTER TABLE student_courses ADD COLUMN graded_by INTEGER;
+ALTER TABLE student_courses ADD COLUMN graded_at TIMESTAMP;
@@ -0,0 +1,10 @@
+-- every issued transcript is kept so a printed copy can be checked against its hash
+CREATE TABLE transcripts(
+	hash TEXT PRIMARY KEY,
+	student_id INTEGER NOT NULL,
+	issued_by INTEGER,
+	issued_at TIMESTAMP NOT NULL,
+	content TEXT NOT NULL
+);
+
+CREATE INDEX idx_transcripts_student ON transcripts(student_id);
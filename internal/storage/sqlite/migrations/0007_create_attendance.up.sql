@@ -0,0 +1,25 @@
+CREATE TABLE course_sessions(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	course_id INTEGER NOT NULL,
+	session_date TEXT NOT NULL,
+	start_time TEXT NOT NULL,
+	end_time TEXT NOT NULL,
+	room TEXT,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_course_sessions_course ON course_sessions(course_id, session_date, start_time);
+
+-- one mark per student and session, marking again overwrites it
+CREATE TABLE attendance(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id INTEGER NOT NULL,
+	student_id INTEGER NOT NULL,
+	status TEXT NOT NULL CHECK (status IN ('present', 'absent', 'late', 'excused')),
+	note TEXT,
+	marked_by INTEGER,
+	marked_at TIMESTAMP NOT NULL,
+	UNIQUE (session_id, student_id)
+);
+
+CREATE INDEX idx_attendance_student ON attendance(student_id);
@@ -0,0 +1,24 @@
+-- refresh tokens are stored hashed, a family is one sign in session
+CREATE TABLE refresh_tokens(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	family_id TEXT NOT NULL,
+	access_jti TEXT NOT NULL,
+	access_expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX idx_refresh_tokens_user ON refresh_tokens(user_id);
+
+-- access tokens signed out before they expire, rows can go once expires_at has passed
+CREATE TABLE revoked_tokens(
+	jti TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+
+-- single use tokens of the password reset and email verification flows, stored hashed
+CREATE TABLE account_tokens(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	purpose TEXT NOT NULL CHECK (purpose IN ('password_reset', 'email_verification')),
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP
+);
+
+CREATE INDEX idx_account_tokens_user ON account_tokens(user_id, purpose);
@@ -0,0 +1,2 @@
+DROP INDEX idx_students_user;
+ALTER TABLE students DROP COLUMN user_id;
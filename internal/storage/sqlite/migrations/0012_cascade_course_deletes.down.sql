@@ -0,0 +1,101 @@
+-- the tables get their previous definitions back, without the delete cascades.
+-- attendance goes first, dropping the sessions it points at would cascade into it.
+CREATE TABLE attendance_old(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id INTEGER NOT NULL,
+	student_id INTEGER NOT NULL,
+	status TEXT NOT NULL CHECK (status IN ('present', 'absent', 'late', 'excused')),
+	note TEXT,
+	marked_by INTEGER,
+	marked_at TIMESTAMP NOT NULL,
+	UNIQUE (session_id, student_id)
+);
+
+INSERT INTO attendance_old (id, session_id, student_id, status, note, marked_by, marked_at)
+SELECT id, session_id, student_id, status, note, marked_by, marked_at FROM attendance;
+
+DROP TABLE attendance;
+
+ALTER TABLE attendance_old RENAME TO attendance;
+
+CREATE INDEX idx_attendance_student ON attendance(student_id);
+
+CREATE TABLE course_sessions_old(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	course_id INTEGER NOT NULL,
+	session_date TEXT NOT NULL,
+	start_time TEXT NOT NULL,
+	end_time TEXT NOT NULL,
+	room TEXT,
+	created_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO course_sessions_old (id, course_id, session_date, start_time, end_time, room, created_at)
+SELECT id, course_id, session_date, start_time, end_time, room, created_at FROM course_sessions;
+
+DROP TABLE course_sessions;
+
+ALTER TABLE course_sessions_old RENAME TO course_sessions;
+
+CREATE INDEX idx_course_sessions_course ON course_sessions(course_id, session_date, start_time);
+
+CREATE TABLE course_prerequisites_old(
+	course_id INTEGER NOT NULL,
+	prerequisite_id INTEGER NOT NULL,
+	min_grade TEXT,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (course_id, prerequisite_id)
+);
+
+INSERT INTO course_prerequisites_old (course_id, prerequisite_id, min_grade, created_at)
+SELECT course_id, prerequisite_id, min_grade, created_at FROM course_prerequisites;
+
+DROP TABLE course_prerequisites;
+
+ALTER TABLE course_prerequisites_old RENAME TO course_prerequisites;
+
+CREATE TABLE course_waitlist_old(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL,
+	status TEXT NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'promoted', 'removed')),
+	created_at TIMESTAMP NOT NULL,
+	promoted_at TIMESTAMP
+);
+
+INSERT INTO course_waitlist_old (id, student_id, course_id, status, created_at, promoted_at)
+SELECT id, student_id, course_id, status, created_at, promoted_at FROM course_waitlist;
+
+DROP TABLE course_waitlist;
+
+ALTER TABLE course_waitlist_old RENAME TO course_waitlist;
+
+CREATE UNIQUE INDEX idx_course_waitlist_waiting ON course_waitlist(student_id, course_id) WHERE status = 'waiting';
+CREATE INDEX idx_course_waitlist_course ON course_waitlist(course_id, status, id);
+
+CREATE TABLE student_courses_old(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL,
+	enrolled_at TIMESTAMP,
+	dropped_at TIMESTAMP,
+	drop_reason TEXT,
+	grade TEXT,
+	completed_at TIMESTAMP,
+	score REAL,
+	grade_points REAL,
+	graded_by INTEGER,
+	graded_at TIMESTAMP,
+	FOREIGN KEY (student_id) REFERENCES students(id),
+	FOREIGN KEY (course_id) REFERENCES courses(id)
+);
+
+INSERT INTO student_courses_old (id, student_id, course_id, enrolled_at, dropped_at, drop_reason, grade, completed_at, score, grade_points, graded_by, graded_at)
+SELECT id, student_id, course_id, enrolled_at, dropped_at, drop_reason, grade, completed_at, score, grade_points, graded_by, graded_at FROM student_courses;
+
+DROP TABLE student_courses;
+
+ALTER TABLE student_courses_old RENAME TO student_courses;
+
+CREATE UNIQUE INDEX idx_student_courses_active ON student_courses(student_id, course_id) WHERE dropped_at IS NULL;
+CREATE INDEX idx_student_courses_course ON student_courses(course_id);
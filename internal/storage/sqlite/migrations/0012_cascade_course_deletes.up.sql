@@ -0,0 +1,108 @@
+-- deleting a course takes its enrollments, prerequisites, sessions (with their attendance) and
+-- waitlist entries along, like on postgres. Foreign keys are enforced from this version on, so
+-- the rows earlier course deletes left behind are not copied.
+CREATE TABLE student_courses_new(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL,
+	enrolled_at TIMESTAMP,
+	dropped_at TIMESTAMP,
+	drop_reason TEXT,
+	grade TEXT,
+	completed_at TIMESTAMP,
+	score REAL,
+	grade_points REAL,
+	graded_by INTEGER,
+	graded_at TIMESTAMP,
+	FOREIGN KEY (student_id) REFERENCES students(id),
+	FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE
+);
+
+INSERT INTO student_courses_new (id, student_id, course_id, enrolled_at, dropped_at, drop_reason, grade, completed_at, score, grade_points, graded_by, graded_at)
+SELECT id, student_id, course_id, enrolled_at, dropped_at, drop_reason, grade, completed_at, score, grade_points, graded_by, graded_at FROM student_courses
+WHERE course_id IN (SELECT id FROM courses) AND student_id IN (SELECT id FROM students);
+
+DROP TABLE student_courses;
+
+ALTER TABLE student_courses_new RENAME TO student_courses;
+
+CREATE UNIQUE INDEX idx_student_courses_active ON student_courses(student_id, course_id) WHERE dropped_at IS NULL;
+CREATE INDEX idx_student_courses_course ON student_courses(course_id);
+
+CREATE TABLE course_prerequisites_new(
+	course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+	prerequisite_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+	min_grade TEXT,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (course_id, prerequisite_id)
+);
+
+INSERT INTO course_prerequisites_new (course_id, prerequisite_id, min_grade, created_at)
+SELECT course_id, prerequisite_id, min_grade, created_at FROM course_prerequisites
+WHERE course_id IN (SELECT id FROM courses) AND prerequisite_id IN (SELECT id FROM courses);
+
+DROP TABLE course_prerequisites;
+
+ALTER TABLE course_prerequisites_new RENAME TO course_prerequisites;
+
+-- sessions before attendance, attendance points at the rebuilt table
+CREATE TABLE course_sessions_new(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+	session_date TEXT NOT NULL,
+	start_time TEXT NOT NULL,
+	end_time TEXT NOT NULL,
+	room TEXT,
+	created_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO course_sessions_new (id, course_id, session_date, start_time, end_time, room, created_at)
+SELECT id, course_id, session_date, start_time, end_time, room, created_at FROM course_sessions
+WHERE course_id IN (SELECT id FROM courses);
+
+DROP TABLE course_sessions;
+
+ALTER TABLE course_sessions_new RENAME TO course_sessions;
+
+CREATE INDEX idx_course_sessions_course ON course_sessions(course_id, session_date, start_time);
+
+CREATE TABLE attendance_new(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id INTEGER NOT NULL REFERENCES course_sessions(id) ON DELETE CASCADE,
+	student_id INTEGER NOT NULL,
+	status TEXT NOT NULL CHECK (status IN ('present', 'absent', 'late', 'excused')),
+	note TEXT,
+	marked_by INTEGER,
+	marked_at TIMESTAMP NOT NULL,
+	UNIQUE (session_id, student_id)
+);
+
+INSERT INTO attendance_new (id, session_id, student_id, status, note, marked_by, marked_at)
+SELECT id, session_id, student_id, status, note, marked_by, marked_at FROM attendance
+WHERE session_id IN (SELECT id FROM course_sessions);
+
+DROP TABLE attendance;
+
+ALTER TABLE attendance_new RENAME TO attendance;
+
+CREATE INDEX idx_attendance_student ON attendance(student_id);
+
+CREATE TABLE course_waitlist_new(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+	status TEXT NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'promoted', 'removed')),
+	created_at TIMESTAMP NOT NULL,
+	promoted_at TIMESTAMP
+);
+
+INSERT INTO course_waitlist_new (id, student_id, course_id, status, created_at, promoted_at)
+SELECT id, student_id, course_id, status, created_at, promoted_at FROM course_waitlist
+WHERE course_id IN (SELECT id FROM courses);
+
+DROP TABLE course_waitlist;
+
+ALTER TABLE course_waitlist_new RENAME TO course_waitlist;
+
+CREATE UNIQUE INDEX idx_course_waitlist_waiting ON course_waitlist(student_id, course_id) WHERE status = 'waiting';
+CREATE INDEX idx_course_waitlist_course ON course_waitlist(course_id, status, id);
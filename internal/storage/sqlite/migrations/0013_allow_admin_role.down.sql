@@ -0,0 +1 @@
+-- nothing to undo, the rebuilt table is the one 0001 creates on a new database
@@ -0,0 +1,17 @@
+-- databases created before the migrations were adopted by 0001 with the users table they had,
+-- whose role check does not know admins yet. The table is rebuilt with the current check.
+CREATE TABLE users_new(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL CHECK (role IN ('student', 'teacher', 'admin')),
+	email_verified_at TIMESTAMP
+);
+
+INSERT INTO users_new (id, name, email, password, role, email_verified_at)
+SELECT id, name, email, password, role, email_verified_at FROM users;
+
+DROP TABLE users;
+
+ALTER TABLE users_new RENAME TO users;
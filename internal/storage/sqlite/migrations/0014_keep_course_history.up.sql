@@ -0,0 +1,48 @@
+-- enrollments, with their grades and drops, and attendance are history, deleting a course must
+-- not take them along. The storage refuses to delete a course that has any, these keys back it up.
+CREATE TABLE student_courses_new(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	student_id INTEGER NOT NULL,
+	course_id INTEGER NOT NULL,
+	enrolled_at TIMESTAMP,
+	dropped_at TIMESTAMP,
+	drop_reason TEXT,
+	grade TEXT,
+	completed_at TIMESTAMP,
+	score REAL,
+	grade_points REAL,
+	graded_by INTEGER,
+	graded_at TIMESTAMP,
+	FOREIGN KEY (student_id) REFERENCES students(id),
+	FOREIGN KEY (course_id) REFERENCES courses(id)
+);
+
+INSERT INTO student_courses_new (id, student_id, course_id, enrolled_at, dropped_at, drop_reason, grade, completed_at, score, grade_points, graded_by, graded_at)
+SELECT id, student_id, course_id, enrolled_at, dropped_at, drop_reason, grade, completed_at, score, grade_points, graded_by, graded_at FROM student_courses;
+
+DROP TABLE student_courses;
+
+ALTER TABLE student_courses_new RENAME TO student_courses;
+
+CREATE UNIQUE INDEX idx_student_courses_active ON student_courses(student_id, course_id) WHERE dropped_at IS NULL;
+CREATE INDEX idx_student_courses_course ON student_courses(course_id);
+
+CREATE TABLE attendance_new(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id INTEGER NOT NULL REFERENCES course_sessions(id),
+	student_id INTEGER NOT NULL,
+	status TEXT NOT NULL CHECK (status IN ('present', 'absent', 'late', 'excused')),
+	note TEXT,
+	marked_by INTEGER,
+	marked_at TIMESTAMP NOT NULL,
+	UNIQUE (session_id, student_id)
+);
+
+INSERT INTO attendance_new (id, session_id, student_id, status, note, marked_by, marked_at)
+SELECT id, session_id, student_id, status, note, marked_by, marked_at FROM attendance;
+
+DROP TABLE attendance;
+
+ALTER TABLE attendance_new RENAME TO attendance;
+
+CREATE INDEX idx_attendance_student ON attendance(student_id);
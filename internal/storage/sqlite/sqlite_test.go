@@ -0,0 +1,137 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/grading"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/storage/storagetest"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		//a file, every connection to :memory: would get a database of its own
+		s, err := New(&config.Config{StoragePath: filepath.Join(t.TempDir(), "students.db"), GradeScale: grading.DefaultScale})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Db.Close() })
+
+		migrator, err := s.Migrator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		return s
+	})
+}
+
+// the tables the service created on startup before schema migrations were introduced
+const baselineSchema = `
+CREATE TABLE students(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT,
+	email TEXT,
+	age INTEGER,
+	phone TEXT,
+	address TEXT,
+	gender TEXT,
+	enrollment_date TIMESTAMP,
+	status TEXT,
+	deleted_at TIMESTAMP
+);
+CREATE TABLE users(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL CHECK (role IN ('student', 'teacher'))
+);
+CREATE TABLE courses(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	course_code TEXT NOT NULL UNIQUE,
+	course_name TEXT NOT NULL UNIQUE,
+	description TEXT,
+	credits INTEGER NOT NULL,
+	instructor TEXT,
+	department TEXT,
+	semester TEXT,
+	academic_year TEXT,
+	capacity INTEGER,
+	status TEXT,
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP
+);
+CREATE TABLE student_courses(
+	student_id INTEGER,
+	course_id INTEGER,
+	enrolled_at TIMESTAMP,
+	PRIMARY KEY (student_id, course_id),
+	FOREIGN KEY (student_id) REFERENCES student(id),
+	FOREIGN KEY (course_id) REFERENCES courses(id)
+);
+INSERT INTO students (id, name, email, status) VALUES (1, 'student', 'student@example.com', 'active');
+INSERT INTO users (id, name, email, password, role) VALUES (1, 'teacher', 'teacher@example.com', 'hash', 'teacher');
+INSERT INTO courses (id, course_code, course_name, credits, capacity, status) VALUES (1, 'CS101', 'Programming', 3, 10, 'active');
+INSERT INTO student_courses (student_id, course_id, enrolled_at) VALUES (1, 1, CURRENT_TIMESTAMP);
+-- the course was hard deleted while the student was still enrolled
+INSERT INTO student_courses (student_id, course_id, enrolled_at) VALUES (1, 2, CURRENT_TIMESTAMP);
+`
+
+func TestMigrateBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "students.db")
+
+	//the baseline did not enforce foreign keys
+	baseline, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := baseline.Exec(baselineSchema); err != nil {
+		t.Fatal(err)
+	}
+	baseline.Close()
+
+	s, err := New(&config.Config{StoragePath: path, GradeScale: grading.DefaultScale})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Db.Close()
+
+	migrator, err := s.Migrator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var courseIds []int64
+	rows, err := s.Db.Query("SELECT course_id FROM student_courses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var courseId int64
+		if err := rows.Scan(&courseId); err != nil {
+			t.Fatal(err)
+		}
+		courseIds = append(courseIds, courseId)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(courseIds) != 1 || courseIds[0] != 1 {
+		t.Errorf("got enrollments in courses %v, want course 1 only", courseIds)
+	}
+}
@@ -0,0 +1,121 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// Dialect describes how a database differs from the SQL the store is written in. Queries
+// use ? placeholders, read the ids of new rows with LastInsertId and count on a write
+// transaction locking the whole database, like sqlite's immediate transactions do.
+type Dialect struct {
+	Numbered     bool                  // placeholders are written $1, $2, ... instead of ?
+	Returning    bool                  // the ids of new rows are read with RETURNING id
+	RowLocks     bool                  // write transactions run concurrently and lock the rows they depend on, FOR UPDATE and the like
+	Like         string                // the case insensitive LIKE operator
+	Timestamp    string                // a timestamp bind parameter in a select list, where its type can not be inferred
+	TranslateErr func(err error) error // reports the unique violations of the driver as model.ErrDuplicate
+}
+
+// rebind converts the ? placeholders of query to the dialect.
+func (d *Dialect) rebind(query string) string {
+	if !d.Numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func (d *Dialect) translateErr(err error) error {
+	if err == nil || d.TranslateErr == nil {
+		return err
+	}
+	return d.TranslateErr(err)
+}
+
+// queryer runs queries on the database or in a transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+
+	// insert runs an INSERT and returns the id of the new row. Unique violations are
+	// reported as model.ErrDuplicate.
+	insert(ctx context.Context, query string, args ...any) (int64, error)
+
+	// lock returns clause, a row locking clause like FOR UPDATE, when the dialect locks rows.
+	lock(clause string) string
+}
+
+// conn is the queryer of the database or of a transaction, it rebinds every query to the
+// dialect before running it.
+type conn struct {
+	q interface {
+		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+		QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+		QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	}
+	dialect *Dialect
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return c.q.ExecContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return c.q.QueryContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c conn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return c.q.QueryRowContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c conn) insert(ctx context.Context, query string, args ...any) (int64, error) {
+	if c.dialect.Returning {
+		var id int64
+		err := c.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, c.dialect.translateErr(err)
+	}
+
+	result, err := c.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, c.dialect.translateErr(err)
+	}
+
+	return result.LastInsertId()
+}
+
+func (c conn) lock(clause string) string {
+	if !c.dialect.RowLocks {
+		return ""
+	}
+	return " " + clause
+}
+
+// transaction is a database transaction that runs its queries like conn.
+type transaction struct {
+	conn
+	tx *sql.Tx
+}
+
+func (t *transaction) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *transaction) Rollback() error {
+	return t.tx.Rollback()
+}
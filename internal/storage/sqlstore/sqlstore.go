@@ -0,0 +1,2200 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/grading"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/utils"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store implements storage.Storage on a SQL database. The backends open the database and
+// bring its dialect and migrations, the queries and the rules around them are shared.
+type Store struct {
+	Db      *sql.DB
+	conn    conn
+	dialect *Dialect
+	scale   grading.Scale
+}
+
+func New(db *sql.DB, dialect Dialect, scale grading.Scale) *Store {
+	return &Store{
+		Db:      db,
+		conn:    conn{q: db, dialect: &dialect},
+		dialect: &dialect,
+		scale:   scale,
+	}
+}
+
+func (s *Store) begin(ctx context.Context) (*transaction, error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transaction{conn: conn{q: tx, dialect: s.dialect}, tx: tx}, nil
+}
+
+func (s *Store) CreateStudent(ctx context.Context, student model.Student) (int64, error) {
+	return createStudent(ctx, s.conn, student)
+}
+
+// CreateStudents creates all students in a single transaction, none of them when one fails.
+func (s *Store) CreateStudents(ctx context.Context, students []model.Student) ([]int64, error) {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	ids := make([]int64, 0, len(students))
+	for i, student := range students {
+		id, err := createStudent(ctx, tx, student)
+		if err != nil {
+			return nil, &model.BatchError{Index: i, Err: err}
+		}
+		ids = append(ids, id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func createStudent(ctx context.Context, q queryer, student model.Student) (int64, error) {
+
+	exists, err := checkEmailExists(ctx, q, student.Email)
+	if err != nil {
+		return 0, err
+	}
+
+	if exists {
+		return 0, fmt.Errorf("student with this email %s %w", student.Email, model.ErrDuplicate)
+	}
+
+	if student.UserId != nil {
+		if err := checkUserLink(ctx, q, *student.UserId, 0); err != nil {
+			return 0, err
+		}
+	}
+
+	return q.insert(ctx, "INSERT INTO students (name, email, age, phone, address, gender, enrollment_date, status, user_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		student.Name, student.Email, student.Age, student.Phone, student.Address, student.Gender, time.Now(), "active", student.UserId)
+}
+
+func (s *Store) GetStudentById(ctx context.Context, id int64) (model.Student, error) {
+
+	var student model.Student
+
+	err := s.conn.QueryRowContext(ctx, "SELECT id, name, email, age, phone, address, gender, enrollment_date, status, user_id FROM students WHERE id = ? AND deleted_at IS NULL LIMIT 1", id).
+		Scan(&student.Id, &student.Name, &student.Email, &student.Age, &student.Phone, &student.Address, &student.Gender, &student.EnrollmentDate, &student.Status, &student.UserId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Student{}, err
+		}
+		return model.Student{}, fmt.Errorf("query error: %w", err)
+	}
+
+	return student, nil
+}
+
+func (s *Store) GetStudents(ctx context.Context, query model.ListQuery) ([]model.Student, *model.PageMeta, error) {
+	where, args, err := listWhere(query, model.StudentFilterFields, "deleted_at IS NULL")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var total int64
+	err = s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM students WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page, pageArgs, err := listPage(query, model.StudentSortFields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := s.conn.QueryContext(ctx, "SELECT id, name, email, age, phone, address, gender, enrollment_date, status, user_id, "+query.Sort+" FROM students WHERE "+where+page, append(args, pageArgs...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	var students []model.Student
+	var sortValues []any
+
+	for rows.Next() {
+		var student model.Student
+		var sortValue any
+
+		err := rows.Scan(&student.Id, &student.Name, &student.Email, &student.Age, &student.Phone, &student.Address, &student.Gender, &student.EnrollmentDate, &student.Status, &student.UserId, &sortValue)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		students = append(students, student)
+		sortValues = append(sortValues, sortValue)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	meta := pageMeta(query, total)
+	if len(students) > query.Limit {
+		students = students[:query.Limit]
+		meta.NextCursor = nextCursor(query, students[len(students)-1].Id, sortValues[query.Limit-1])
+	}
+
+	return students, meta, nil
+}
+
+// DeleteStudentById soft deletes the student. Their enrollments are dropped in the same
+// transaction, so the freed seats go to the waitlists right away, and their own waitlist
+// places are given up.
+func (s *Store) DeleteStudentById(ctx context.Context, studentId int64) (int64, error) {
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	res, err := tx.ExecContext(ctx, "UPDATE students SET deleted_at = ? WHERE id = ?", now, studentId)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if rows == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	courseIds, err := activeCourses(ctx, tx, studentId)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE student_courses SET dropped_at = ?, drop_reason = ? WHERE student_id = ? AND dropped_at IS NULL", now, "student deleted", studentId)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE course_waitlist SET status = ? WHERE student_id = ? AND status = ?", model.WaitlistRemoved, studentId, model.WaitlistWaiting)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, courseId := range courseIds {
+		if _, err := promoteFromWaitlist(ctx, tx, courseId); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return studentId, nil
+
+}
+
+// activeCourses returns the courses the student is currently enrolled in.
+func activeCourses(ctx context.Context, tx *transaction, studentId int64) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT course_id FROM student_courses WHERE student_id = ? AND dropped_at IS NULL ORDER BY course_id", studentId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var courseIds []int64
+	for rows.Next() {
+		var courseId int64
+		if err := rows.Scan(&courseId); err != nil {
+			return nil, err
+		}
+		courseIds = append(courseIds, courseId)
+	}
+
+	return courseIds, rows.Err()
+}
+
+func (s *Store) UpdateStudentById(ctx context.Context, studentId int64, req model.StudentUpdateRequest) (int64, error) {
+	var fields []string
+	var args []any
+
+	if req.Name != nil {
+		fields = append(fields, "name = ?")
+		args = append(args, *req.Name)
+	}
+
+	if req.Email != nil {
+		fields = append(fields, "email = ?")
+		args = append(args, *req.Email)
+	}
+
+	if req.Age != nil {
+		fields = append(fields, "age = ?")
+		args = append(args, *req.Age)
+	}
+
+	if req.Phone != nil {
+		fields = append(fields, "phone = ?")
+		args = append(args, *req.Phone)
+	}
+
+	if req.Address != nil {
+		fields = append(fields, "address = ?")
+		args = append(args, *req.Address)
+	}
+
+	if req.Gender != nil {
+		fields = append(fields, "gender = ?")
+		args = append(args, *req.Gender)
+	}
+
+	if req.EnrollmentDate != nil {
+		fields = append(fields, "enrollment_date = ?")
+		args = append(args, *req.EnrollmentDate)
+	}
+
+	if req.Status != nil {
+		fields = append(fields, "status = ?")
+		args = append(args, *req.Status)
+	}
+
+	//0 removes the link to the user account
+	if req.UserId != nil {
+		if *req.UserId == 0 {
+			fields = append(fields, "user_id = NULL")
+		} else {
+			if err := checkUserLink(ctx, s.conn, *req.UserId, studentId); err != nil {
+				return 0, err
+			}
+			fields = append(fields, "user_id = ?")
+			args = append(args, *req.UserId)
+		}
+	}
+
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("no fields to update")
+	}
+
+	args = append(args, studentId)
+	query := fmt.Sprintf("UPDATE students SET %s WHERE id = ?", strings.Join(fields, ", "))
+
+	result, err := s.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if rows == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	return studentId, nil
+}
+
+func (s *Store) SearchStudent(ctx context.Context, queryStr string) (*[]model.Student, error) {
+
+	rows, err := s.conn.QueryContext(ctx, "SELECT id, name, email, age, phone, address, gender, enrollment_date, status, user_id FROM students WHERE name "+s.dialect.Like+" ?", "%"+queryStr+"%")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var students []model.Student
+
+	for rows.Next() {
+		var student model.Student
+		err := rows.Scan(&student.Id, &student.Name, &student.Email, &student.Age, &student.Phone, &student.Address, &student.Gender, &student.EnrollmentDate, &student.Status, &student.UserId)
+		if err != nil {
+			return nil, err
+		}
+		students = append(students, student)
+	}
+
+	if len(students) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return &students, nil
+}
+
+func (s *Store) IsEmailTaken(ctx context.Context, email string) (bool, error) {
+
+	var count int
+	err := s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, user model.User) (int64, error) {
+	return s.conn.insert(ctx, "INSERT INTO users (name, email, password, role, email_verified_at) VALUES (?, ?, ?, ?, ?)",
+		user.Name, user.Email, user.Password, user.Role, user.EmailVerifiedAt)
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	var user model.User
+
+	err := s.conn.QueryRowContext(ctx, "SELECT id, name, email, password, role, email_verified_at FROM users WHERE email = ? LIMIT 1", email).
+		Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &user.EmailVerifiedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func checkEmailExists(ctx context.Context, q queryer, email string) (bool, error) {
+	var count int
+	err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM students WHERE email = ?", email).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+//course
+
+func (s *Store) CreateCourse(ctx context.Context, course model.Course) (int64, error) {
+	return createCourse(ctx, s.conn, course)
+}
+
+// CreateCourses creates all courses in a single transaction, none of them when one fails.
+func (s *Store) CreateCourses(ctx context.Context, courses []model.Course) ([]int64, error) {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	ids := make([]int64, 0, len(courses))
+	for i, course := range courses {
+		id, err := createCourse(ctx, tx, course)
+		if err != nil {
+			return nil, &model.BatchError{Index: i, Err: err}
+		}
+		ids = append(ids, id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func createCourse(ctx context.Context, q queryer, course model.Course) (int64, error) {
+	return q.insert(ctx, "INSERT INTO courses (course_code, course_name, description, credits, instructor, department, semester, academic_year, capacity, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		course.CourseCode, course.CourseName, course.Description, course.Credits,
+		course.Instructor, course.Department, course.Semester, course.AcademicYear,
+		course.Capacity, course.Status, course.CreatedAt, course.UpdatedAt)
+}
+
+func (s *Store) GetCourseById(ctx context.Context, id int64) (*model.Course, error) {
+
+	var course model.Course
+
+	err := s.conn.QueryRowContext(ctx, "SELECT id, course_code, course_name, description, credits, instructor, department, semester, academic_year, capacity, status, created_at, updated_at FROM courses WHERE id = ?", id).
+		Scan(&course.Id, &course.CourseCode, &course.CourseName, &course.Description, &course.Credits,
+			&course.Instructor, &course.Department, &course.Semester, &course.AcademicYear,
+			&course.Capacity, &course.Status, &course.CreatedAt, &course.UpdatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &course, nil
+}
+
+func (s *Store) GetAllCourses(ctx context.Context, query model.ListQuery) ([]model.Course, *model.PageMeta, error) {
+
+	var courses []model.Course
+	var sortValues []any
+
+	where, args, err := listWhere(query, model.CourseFilterFields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var total int64
+	err = s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM courses WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page, pageArgs, err := listPage(query, model.CourseSortFields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := s.conn.QueryContext(ctx, "SELECT id, course_code, course_name, description, credits, instructor, department, semester, academic_year, capacity, status, created_at, updated_at, "+query.Sort+" FROM courses WHERE "+where+page, append(args, pageArgs...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var course model.Course
+		var sortValue any
+
+		err := rows.Scan(&course.Id, &course.CourseCode, &course.CourseName, &course.Description, &course.Credits,
+			&course.Instructor, &course.Department, &course.Semester, &course.AcademicYear,
+			&course.Capacity, &course.Status, &course.CreatedAt, &course.UpdatedAt, &sortValue)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		courses = append(courses, course)
+		sortValues = append(sortValues, sortValue)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	meta := pageMeta(query, total)
+	if len(courses) > query.Limit {
+		courses = courses[:query.Limit]
+		meta.NextCursor = nextCursor(query, courses[len(courses)-1].Id, sortValues[query.Limit-1])
+	}
+
+	return courses, meta, nil
+}
+
+func (s *Store) UpdateCourse(ctx context.Context, id int64, req model.CourseUpdateRequest) (*model.Course, error) {
+	var fields []string
+	var args []any
+
+	if req.CourseCode != nil {
+		fields = append(fields, "course_code = ?")
+		args = append(args, *req.CourseCode)
+	}
+
+	if req.CourseName != nil {
+		fields = append(fields, "course_name = ?")
+		args = append(args, *req.CourseName)
+	}
+
+	if req.Description != nil {
+		fields = append(fields, "description = ?")
+		args = append(args, *req.Description)
+	}
+
+	if req.Credits != nil {
+		fields = append(fields, "credits = ?")
+		args = append(args, *req.Credits)
+	}
+
+	if req.Instructor != nil {
+		fields = append(fields, "instructor = ?")
+		args = append(args, *req.Instructor)
+	}
+
+	if req.Department != nil {
+		fields = append(fields, "department = ?")
+		args = append(args, *req.Department)
+	}
+
+	if req.Semester != nil {
+		fields = append(fields, "semester = ?")
+		args = append(args, *req.Semester)
+	}
+
+	if req.AcademicYear != nil {
+		fields = append(fields, "academic_year = ?")
+		args = append(args, *req.AcademicYear)
+	}
+
+	if req.Capacity != nil {
+		fields = append(fields, "capacity = ?")
+		args = append(args, *req.Capacity)
+	}
+
+	if req.Status != nil {
+		fields = append(fields, "status = ?")
+		args = append(args, *req.Status)
+	}
+
+	if req.UpdatedAt != nil {
+		fields = append(fields, "updated_at = ?")
+		args = append(args, *req.UpdatedAt)
+	}
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE courses SET %s WHERE id = ?", strings.Join(fields, ", "))
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, s.dialect.translateErr(err)
+	}
+
+	//a higher capacity or a reactivated course can free up seats for waitlisted students
+	if req.Capacity != nil || req.Status != nil {
+		if _, err := promoteFromWaitlist(ctx, tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	course, err := s.GetCourseById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return course, nil
+}
+
+func (s *Store) DeleteCourseById(ctx context.Context, id int64) (int64, error) {
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	//locks the course like an enrollment does, so no enrollment can slip in before the delete
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM courses WHERE id = ?"+tx.lock("FOR UPDATE"), id).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	//enrollments and attendance are history, a course that has any is set inactive instead
+	var hasHistory bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM student_courses WHERE course_id = ?)
+		OR EXISTS (SELECT 1 FROM attendance a JOIN course_sessions cs ON cs.id = a.session_id WHERE cs.course_id = ?)`, id, id).Scan(&hasHistory)
+	if err != nil {
+		return 0, err
+	}
+
+	if hasHistory {
+		return 0, model.ErrCourseHasHistory
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM courses WHERE id = ?", id); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (s *Store) SearchCourse(ctx context.Context, query string) (*[]model.Course, error) {
+
+	rows, err := s.conn.QueryContext(ctx, "SELECT id, course_code, course_name, description, credits, instructor, department, semester, academic_year, capacity, status, created_at, updated_at FROM courses WHERE course_name "+s.dialect.Like+" ?", "%"+query+"%")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var courses []model.Course
+
+	for rows.Next() {
+		var course model.Course
+		err := rows.Scan(&course.Id, &course.CourseCode, &course.CourseName, &course.Description, &course.Credits,
+			&course.Instructor, &course.Department, &course.Semester, &course.AcademicYear,
+			&course.Capacity, &course.Status, &course.CreatedAt, &course.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		courses = append(courses, course)
+	}
+
+	if len(courses) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return &courses, nil
+}
+
+//prerequisites
+
+func (s *Store) GetCoursePrerequisites(ctx context.Context, courseId int64) ([]model.Prerequisite, error) {
+
+	var exists int
+	err := s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM courses WHERE id = ?", courseId).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return coursePrerequisites(ctx, s.conn, courseId)
+}
+
+func (s *Store) AddCoursePrerequisite(ctx context.Context, courseId int64, prerequisite model.Prerequisite) (*model.Prerequisite, error) {
+
+	if prerequisite.PrerequisiteId == courseId {
+		return nil, model.ErrInvalidPrerequisite
+	}
+
+	if prerequisite.MinGrade != "" {
+		grade, ok := s.scale.Find(prerequisite.MinGrade)
+		if !ok {
+			return nil, fmt.Errorf("%w %s", model.ErrInvalidGrade, prerequisite.MinGrade)
+		}
+		prerequisite.MinGrade = grade.Letter
+	}
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var found int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM courses WHERE id IN (?, ?)", courseId, prerequisite.PrerequisiteId).Scan(&found)
+	if err != nil {
+		return nil, err
+	}
+
+	if found != 2 {
+		return nil, sql.ErrNoRows
+	}
+
+	//the new edge would close a loop if the course is already required, directly or not, by its prerequisite
+	var loops int
+	err = tx.QueryRowContext(ctx, `WITH RECURSIVE chain(id) AS (
+			SELECT prerequisite_id FROM course_prerequisites WHERE course_id = ?
+			UNION
+			SELECT p.prerequisite_id FROM course_prerequisites p JOIN chain ON p.course_id = chain.id
+		)
+		SELECT COUNT(*) FROM chain WHERE id = ?`, prerequisite.PrerequisiteId, courseId).Scan(&loops)
+	if err != nil {
+		return nil, err
+	}
+
+	if loops > 0 {
+		return nil, model.ErrInvalidPrerequisite
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO course_prerequisites (course_id, prerequisite_id, min_grade, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (course_id, prerequisite_id) DO UPDATE SET min_grade = excluded.min_grade`,
+		courseId, prerequisite.PrerequisiteId, prerequisite.MinGrade, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	prerequisites, err := coursePrerequisites(ctx, tx, courseId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, added := range prerequisites {
+		if added.PrerequisiteId == prerequisite.PrerequisiteId {
+			return &added, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) DeleteCoursePrerequisite(ctx context.Context, courseId int64, prerequisiteId int64) error {
+
+	res, err := s.conn.ExecContext(ctx, "DELETE FROM course_prerequisites WHERE course_id = ? AND prerequisite_id = ?", courseId, prerequisiteId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func coursePrerequisites(ctx context.Context, q queryer, courseId int64) ([]model.Prerequisite, error) {
+
+	rows, err := q.QueryContext(ctx, `SELECT p.course_id, p.prerequisite_id, c.course_code, c.course_name, p.min_grade
+		FROM course_prerequisites p JOIN courses c ON c.id = p.prerequisite_id
+		WHERE p.course_id = ? ORDER BY c.course_code`, courseId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var prerequisites []model.Prerequisite
+
+	for rows.Next() {
+		var prerequisite model.Prerequisite
+		var minGrade sql.NullString
+		err := rows.Scan(&prerequisite.CourseId, &prerequisite.PrerequisiteId, &prerequisite.PrerequisiteCode, &prerequisite.PrerequisiteName, &minGrade)
+		if err != nil {
+			return nil, err
+		}
+
+		prerequisite.MinGrade = minGrade.String
+		prerequisites = append(prerequisites, prerequisite)
+	}
+
+	return prerequisites, rows.Err()
+}
+
+// unmetPrerequisites returns the prerequisites of the course the student has not completed
+// with a good enough grade.
+func unmetPrerequisites(ctx context.Context, tx *transaction, scale grading.Scale, studentId int64, courseId int64) ([]model.Prerequisite, error) {
+
+	prerequisites, err := coursePrerequisites(ctx, tx, courseId)
+	if err != nil {
+		return nil, err
+	}
+
+	var unmet []model.Prerequisite
+
+	for _, prerequisite := range prerequisites {
+		grades, err := completedGrades(ctx, tx, studentId, prerequisite.PrerequisiteId)
+		if err != nil {
+			return nil, err
+		}
+
+		met := false
+		for _, grade := range grades {
+			if scale.Meets(grade, prerequisite.MinGrade) {
+				met = true
+				break
+			}
+		}
+
+		if !met {
+			unmet = append(unmet, prerequisite)
+		}
+	}
+
+	return unmet, nil
+}
+
+// completedGrades returns the grade of every completed attempt of the course by the student
+func completedGrades(ctx context.Context, tx *transaction, studentId int64, courseId int64) ([]string, error) {
+
+	rows, err := tx.QueryContext(ctx, "SELECT grade FROM student_courses WHERE student_id = ? AND course_id = ? AND completed_at IS NOT NULL AND dropped_at IS NULL", studentId, courseId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var grades []string
+
+	for rows.Next() {
+		var grade sql.NullString
+		if err := rows.Scan(&grade); err != nil {
+			return nil, err
+		}
+		grades = append(grades, grade.String)
+	}
+
+	return grades, rows.Err()
+}
+
+//pagination
+
+// listWhere builds the WHERE clause shared by the count and page queries of a list endpoint.
+func listWhere(query model.ListQuery, filterFields []string, conditions ...string) (string, []any, error) {
+	var args []any
+
+	for field, value := range query.Filters {
+		//field names end up in the query so only known columns are allowed
+		if !slices.Contains(filterFields, field) {
+			return "", nil, fmt.Errorf("can not filter by %s", field)
+		}
+		conditions = append(conditions, field+" = ?")
+		args = append(args, value)
+	}
+
+	if len(conditions) == 0 {
+		return "1 = 1", args, nil
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// listPage builds the ORDER BY and LIMIT part of a list query. When a cursor is set it
+// continues right after the row the cursor points to, using (sort column, id) as the key.
+// NULLs sort as if they were above every value, last in ascending and first in descending
+// order, spelled out so every backend agrees.
+func listPage(query model.ListQuery, sortFields []string) (string, []any, error) {
+	if !slices.Contains(sortFields, query.Sort) {
+		return "", nil, fmt.Errorf("can not sort by %s", query.Sort)
+	}
+
+	var clause string
+	var args []any
+
+	if after := query.After; after != nil {
+		switch {
+		case after.Value == nil && !query.Desc:
+			clause = fmt.Sprintf(" AND %s IS NULL AND id > ?", query.Sort)
+			args = append(args, after.Id)
+		case after.Value == nil:
+			clause = fmt.Sprintf(" AND (%s IS NOT NULL OR id < ?)", query.Sort)
+			args = append(args, after.Id)
+		case !query.Desc:
+			clause = fmt.Sprintf(" AND (%[1]s > ? OR (%[1]s = ? AND id > ?) OR %[1]s IS NULL)", query.Sort)
+			args = append(args, after.Value, after.Value, after.Id)
+		default:
+			clause = fmt.Sprintf(" AND (%[1]s < ? OR (%[1]s = ? AND id < ?))", query.Sort)
+			args = append(args, after.Value, after.Value, after.Id)
+		}
+	}
+
+	//one extra row tells us whether there is a next page
+	if query.Desc {
+		clause += fmt.Sprintf(" ORDER BY %s DESC NULLS FIRST, id DESC LIMIT ? OFFSET ?", query.Sort)
+	} else {
+		clause += fmt.Sprintf(" ORDER BY %s ASC NULLS LAST, id ASC LIMIT ? OFFSET ?", query.Sort)
+	}
+	args = append(args, query.Limit+1, query.Offset)
+
+	return clause, args, nil
+}
+
+func pageMeta(query model.ListQuery, total int64) *model.PageMeta {
+	return &model.PageMeta{
+		Total:  total,
+		Limit:  query.Limit,
+		Offset: query.Offset,
+	}
+}
+
+// nextCursor points at the last row of a page, sortValue is the sort column of that row.
+func nextCursor(query model.ListQuery, id int64, sortValue any) string {
+	return utils.EncodeCursor(model.Cursor{Sort: query.Sort, Desc: query.Desc, Value: sortValue, Id: id})
+}
+
+func (s *Store) EnrollStudentInCourse(ctx context.Context, studentId int64, req model.EnrollRequest) (*model.EnrollmentResponse, error) {
+
+	var response model.EnrollmentResponse
+
+	response.StudentId = studentId
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	//the student can not be deleted while the enrollment runs
+	var deletedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, "SELECT deleted_at FROM students WHERE id = ?"+tx.lock("FOR SHARE"), studentId).Scan(&deletedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	studentMissing := errors.Is(err, sql.ErrNoRows) || deletedAt.Valid
+
+	for _, courseId := range req.Courses {
+		if studentMissing {
+			response.FailedCourses = append(response.FailedCourses, model.EnrollmentFail{
+				CourseID: courseId,
+				Code:     model.EnrollErrStudentNotFound,
+				Error:    fmt.Sprintf("no student found for the id %d", studentId),
+			})
+			continue
+		}
+
+		fail, err := enrollmentFailure(ctx, tx, s.scale, studentId, courseId)
+		if err != nil {
+			return nil, err
+		}
+
+		if fail != nil && fail.Code == model.EnrollErrCourseFull {
+			entry, err := joinWaitlist(ctx, tx, studentId, courseId)
+			if err != nil {
+				return nil, err
+			}
+
+			if entry != nil {
+				response.Waitlisted = append(response.Waitlisted, *entry)
+				continue
+			}
+
+			fail = &model.EnrollmentFail{CourseID: courseId, Code: model.EnrollErrWaitlisted, Error: "course is full and the student is already on its waitlist"}
+		}
+
+		if fail == nil {
+			fail, err = enroll(ctx, tx, studentId, courseId)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if fail != nil {
+			response.FailedCourses = append(response.FailedCourses, *fail)
+		} else {
+			response.EnrolledCourses = append(response.EnrolledCourses, courseId)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// enroll inserts the enrollment. When the insert fails the course is reported as failed and
+// the transaction goes on with the other courses, the savepoint undoes the failed statement,
+// which would otherwise abort the whole transaction on postgres.
+func enroll(ctx context.Context, tx *transaction, studentId int64, courseId int64) (*model.EnrollmentFail, error) {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT enroll"); err != nil {
+		return nil, err
+	}
+
+	_, err := tx.ExecContext(ctx, "INSERT INTO student_courses (student_id, course_id, enrolled_at) VALUES (?, ?, ?)", studentId, courseId, time.Now())
+	if err != nil {
+		if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT enroll"); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT enroll"); err != nil {
+		return nil, err
+	}
+
+	if err != nil {
+		return &model.EnrollmentFail{CourseID: courseId, Code: model.EnrollErrInternal, Error: err.Error()}, nil
+	}
+
+	return nil, nil
+}
+
+// enrollmentFailure checks whether the student can be enrolled in the course and returns
+// the reason when they can not. The course stays locked until the transaction ends, by its
+// row lock or the write lock of the database, so concurrent enrollments can not both take
+// the last seat.
+func enrollmentFailure(ctx context.Context, tx *transaction, scale grading.Scale, studentId int64, courseId int64) (*model.EnrollmentFail, error) {
+
+	var capacity sql.NullInt64
+	var status sql.NullString
+	err := tx.QueryRowContext(ctx, "SELECT capacity, status FROM courses WHERE id = ?"+tx.lock("FOR UPDATE"), courseId).Scan(&capacity, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &model.EnrollmentFail{CourseID: courseId, Code: model.EnrollErrCourseNotFound, Error: "course not found"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if status.String == "inactive" {
+		return &model.EnrollmentFail{CourseID: courseId, Code: model.EnrollErrCourseInactive, Error: "course is not active"}, nil
+	}
+
+	var enrolled int64
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM student_courses WHERE student_id = ? AND course_id = ? AND dropped_at IS NULL", studentId, courseId).Scan(&enrolled)
+	if err != nil {
+		return nil, err
+	}
+
+	if enrolled > 0 {
+		return &model.EnrollmentFail{CourseID: courseId, Code: model.EnrollErrAlreadyEnrolled, Error: "student is already enrolled in this course"}, nil
+	}
+
+	unmet, err := unmetPrerequisites(ctx, tx, scale, studentId, courseId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unmet) > 0 {
+		return &model.EnrollmentFail{CourseID: courseId, Code: model.EnrollErrPrerequisites, Error: "student has not completed the prerequisites of this course", UnmetPrerequisites: unmet}, nil
+	}
+
+	//a capacity of 0 means the course has no limit
+	if capacity.Int64 > 0 {
+		var taken int64
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM student_courses WHERE course_id = ? AND dropped_at IS NULL", courseId).Scan(&taken)
+		if err != nil {
+			return nil, err
+		}
+
+		if taken >= capacity.Int64 {
+			return &model.EnrollmentFail{CourseID: courseId, Code: model.EnrollErrCourseFull, Error: fmt.Sprintf("course is full, all %d seats are taken", capacity.Int64)}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *Store) FetchStudentWithEnrolledCourse(ctx context.Context, studentId int64) (*model.StudentWithCoursesResponse, error) {
+	query := "SELECT s.id AS student_id, s.name AS student_name, s.email AS student_email, c.id AS course_id, c.course_code, c.course_name, c.credits, c.semester, c.status, sc.enrolled_at, sc.dropped_at, sc.drop_reason FROM students s JOIN student_courses sc ON s.id = sc.student_id JOIN courses c ON c.id = sc.course_id WHERE s.id = ? ORDER BY sc.id"
+
+	var response model.StudentWithCoursesResponse
+	var courses []model.Course
+
+	rows, err := s.conn.QueryContext(ctx, query, studentId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var course model.Course
+		var enrolledAt sql.NullTime
+		var droppedAt sql.NullTime
+		var dropReason sql.NullString
+		err := rows.Scan(
+			&response.StudentID,
+			&response.StudentName,
+			&response.StudentEmail,
+			&course.Id,
+			&course.CourseCode,
+			&course.CourseName,
+			&course.Credits,
+			&course.Semester,
+			&course.Status,
+			&enrolledAt,
+			&droppedAt,
+			&dropReason,
+		)
+		if err != nil {
+			slog.Info("error", "error", err)
+			return nil, err
+		}
+
+		//dropped enrollments are kept as history
+		if droppedAt.Valid {
+			response.DroppedCourses = append(response.DroppedCourses, model.DroppedCourse{
+				Course:     course,
+				EnrolledAt: enrolledAt.Time,
+				DroppedAt:  droppedAt.Time,
+				DropReason: dropReason.String,
+			})
+			continue
+		}
+
+		courses = append(courses, course)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	response.Courses = courses
+
+	return &response, nil
+}
+
+func (s *Store) DropStudentCourses(ctx context.Context, studentId int64, req model.DropRequest) (*model.DropResponse, error) {
+
+	response := model.DropResponse{StudentId: studentId}
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	for _, courseId := range req.Courses {
+		//the row is kept with a drop date so the registrar has the full history
+		result, err := tx.ExecContext(ctx, "UPDATE student_courses SET dropped_at = ?, drop_reason = ? WHERE student_id = ? AND course_id = ? AND dropped_at IS NULL", now, req.Reason, studentId, courseId)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rows == 0 {
+			response.FailedCourses = append(response.FailedCourses, model.EnrollmentFail{
+				CourseID: courseId,
+				Code:     model.EnrollErrNotEnrolled,
+				Error:    "student is not enrolled in this course",
+			})
+			continue
+		}
+
+		response.DroppedCourses = append(response.DroppedCourses, courseId)
+
+		promoted, err := promoteFromWaitlist(ctx, tx, courseId)
+		if err != nil {
+			return nil, err
+		}
+		response.Promoted = append(response.Promoted, promoted...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (s *Store) GetStudentByUserId(ctx context.Context, userId int64) (model.Student, error) {
+	var student model.Student
+	err := s.conn.QueryRowContext(ctx, "SELECT id, name, email, age, phone, address, gender, enrollment_date, status, user_id FROM students WHERE user_id = ? AND deleted_at IS NULL", userId).
+		Scan(&student.Id, &student.Name, &student.Email, &student.Age, &student.Phone, &student.Address, &student.Gender, &student.EnrollmentDate, &student.Status, &student.UserId)
+	if err != nil {
+		return model.Student{}, err
+	}
+
+	return student, nil
+}
+
+// checkUserLink fails with model.ErrInvalidUserLink unless userId is a student account that
+// is not linked to another student than studentId.
+func checkUserLink(ctx context.Context, q queryer, userId int64, studentId int64) error {
+	var role string
+	err := q.QueryRowContext(ctx, "SELECT role FROM users WHERE id = ?", userId).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: user %d does not exist", model.ErrInvalidUserLink, userId)
+	}
+	if err != nil {
+		return err
+	}
+
+	if role != model.RoleStudent {
+		return fmt.Errorf("%w: user %d is not a student account", model.ErrInvalidUserLink, userId)
+	}
+
+	var linked int
+	err = q.QueryRowContext(ctx, "SELECT COUNT(*) FROM students WHERE user_id = ? AND id <> ? AND deleted_at IS NULL", userId, studentId).Scan(&linked)
+	if err != nil {
+		return err
+	}
+
+	if linked > 0 {
+		return fmt.Errorf("%w: user %d is already linked to another student", model.ErrInvalidUserLink, userId)
+	}
+
+	return nil
+}
+
+func (s *Store) GetUserById(ctx context.Context, id int64) (*model.User, error) {
+	var user model.User
+	err := s.conn.QueryRowContext(ctx, "SELECT id, name, email, role, email_verified_at FROM users WHERE id = ?", id).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.EmailVerifiedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// SetUserRole changes the role of a user, sql.ErrNoRows when there is no such user.
+func (s *Store) SetUserRole(ctx context.Context, id int64, role string) error {
+	result, err := s.conn.ExecContext(ctx, "UPDATE users SET role = ? WHERE id = ?", role, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+//tokens
+
+func (s *Store) CreateRefreshToken(ctx context.Context, token model.RefreshToken) error {
+	_, err := s.conn.ExecContext(ctx, `INSERT INTO refresh_tokens (user_id, token_hash, family_id, access_jti, access_expires_at, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		token.UserId, token.TokenHash, token.FamilyId, token.AccessJti, token.AccessExpiresAt, token.CreatedAt, token.ExpiresAt)
+	return err
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	var token model.RefreshToken
+	err := s.conn.QueryRowContext(ctx, `SELECT id, user_id, token_hash, family_id, access_jti, access_expires_at, created_at, expires_at, used_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = ?`, tokenHash).Scan(&token.Id, &token.UserId, &token.TokenHash, &token.FamilyId,
+		&token.AccessJti, &token.AccessExpiresAt, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// RotateRefreshToken marks the old token as used and stores its replacement. It returns
+// model.ErrTokenReused when the old token was used or revoked in the meantime.
+func (s *Store) RotateRefreshToken(ctx context.Context, oldId int64, next model.RefreshToken) error {
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL", next.CreatedAt, oldId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return model.ErrTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO refresh_tokens (user_id, token_hash, family_id, access_jti, access_expires_at, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		next.UserId, next.TokenHash, next.FamilyId, next.AccessJti, next.AccessExpiresAt, next.CreatedAt, next.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeSession revokes every refresh token of a sign in session and the access tokens
+// issued with them that have not expired yet.
+func (s *Store) RevokeSession(ctx context.Context, familyId string) error {
+	return s.revokeTokens(ctx, "family_id", familyId)
+}
+
+// RevokeUserSessions signs a user out everywhere.
+func (s *Store) RevokeUserSessions(ctx context.Context, userId int64) error {
+	return s.revokeTokens(ctx, "user_id", userId)
+}
+
+func (s *Store) RevokeAccessToken(ctx context.Context, jti string, userId int64, expiresAt time.Time) error {
+	now := time.Now().UTC()
+
+	_, err := s.conn.ExecContext(ctx, "INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at) VALUES (?, ?, ?, ?) ON CONFLICT (jti) DO NOTHING",
+		jti, userId, expiresAt.UTC(), now)
+	if err != nil {
+		return err
+	}
+
+	//expired tokens are rejected anyway, there is no need to remember them
+	_, err = s.conn.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < ?", now)
+	return err
+}
+
+func (s *Store) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int
+	err := s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?", jti).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (s *Store) revokeTokens(ctx context.Context, column string, arg any) error {
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at)
+		SELECT access_jti, user_id, access_expires_at, `+s.dialect.Timestamp+` FROM refresh_tokens WHERE access_expires_at > ? AND `+column+` = ?
+		ON CONFLICT (jti) DO NOTHING`, now, now, arg)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE revoked_at IS NULL AND "+column+" = ?", now, arg)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//account tokens
+
+// CreateAccountToken stores a new emailed token, invalidating the unused tokens the user
+// has for the same purpose so only the latest email works.
+func (s *Store) CreateAccountToken(ctx context.Context, token model.AccountToken) error {
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE account_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL", token.CreatedAt, token.UserId, token.Purpose)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO account_tokens (user_id, purpose, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		token.UserId, token.Purpose, token.TokenHash, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResetPassword consumes a password reset token and sets the new password hash. It returns
+// the user id, or sql.ErrNoRows when the token is unknown, used or expired.
+func (s *Store) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (int64, error) {
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	userId, err := consumeAccountToken(ctx, tx, tokenHash, model.AccountTokenPasswordReset)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE users SET password = ? WHERE id = ?", passwordHash, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	//receiving the email proves the address as well
+	_, err = tx.ExecContext(ctx, "UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL", time.Now().UTC(), userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return userId, tx.Commit()
+}
+
+// VerifyEmail consumes an email verification token and marks the email of its user as
+// verified, returning sql.ErrNoRows when the token is unknown, used or expired.
+func (s *Store) VerifyEmail(ctx context.Context, tokenHash string) (int64, error) {
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	userId, err := consumeAccountToken(ctx, tx, tokenHash, model.AccountTokenEmailVerification)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE users SET email_verified_at = ? WHERE id = ? AND email_verified_at IS NULL", time.Now().UTC(), userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return userId, tx.Commit()
+}
+
+func consumeAccountToken(ctx context.Context, tx *transaction, tokenHash string, purpose string) (int64, error) {
+
+	now := time.Now().UTC()
+
+	var userId int64
+	err := tx.QueryRowContext(ctx, "SELECT user_id FROM account_tokens WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?"+tx.lock("FOR UPDATE"),
+		tokenHash, purpose, now).Scan(&userId)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE account_tokens SET used_at = ? WHERE token_hash = ?", now, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+//login failures
+
+// GetLoginFailures returns the failed sign in attempts of the subject, with a zero count
+// when there are none.
+func (s *Store) GetLoginFailures(ctx context.Context, scope string, subject string) (model.LoginFailures, error) {
+	failures := model.LoginFailures{Scope: scope, Subject: subject}
+	err := s.conn.QueryRowContext(ctx, "SELECT failures, last_failed_at FROM login_failures WHERE scope = ? AND subject = ?", scope, subject).
+		Scan(&failures.Failures, &failures.LastFailedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return failures, nil
+	}
+	if err != nil {
+		return model.LoginFailures{}, err
+	}
+
+	return failures, nil
+}
+
+// RecordLoginFailure counts a failed sign in attempt made at at. The count starts over when
+// the previous failure happened before since.
+func (s *Store) RecordLoginFailure(ctx context.Context, scope string, subject string, at time.Time, since time.Time) (model.LoginFailures, error) {
+	failures := model.LoginFailures{Scope: scope, Subject: subject}
+	err := s.conn.QueryRowContext(ctx, `INSERT INTO login_failures (scope, subject, failures, last_failed_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT (scope, subject) DO UPDATE SET
+			failures = CASE WHEN login_failures.last_failed_at < ? THEN 1 ELSE login_failures.failures + 1 END,
+			last_failed_at = excluded.last_failed_at
+		RETURNING failures, last_failed_at`,
+		scope, subject, at.UTC(), since.UTC()).Scan(&failures.Failures, &failures.LastFailedAt)
+	if err != nil {
+		return model.LoginFailures{}, err
+	}
+
+	return failures, nil
+}
+
+func (s *Store) ClearLoginFailures(ctx context.Context, scope string, subject string) error {
+	_, err := s.conn.ExecContext(ctx, "DELETE FROM login_failures WHERE scope = ? AND subject = ?", scope, subject)
+	return err
+}
+
+//grades
+
+func (s *Store) RecordGrade(ctx context.Context, studentId int64, courseId int64, req model.GradeRequest, gradedBy int64) (*model.CourseGrade, error) {
+
+	var grade grading.Grade
+	var ok bool
+
+	switch {
+	case req.LetterGrade != nil:
+		grade, ok = s.scale.Find(*req.LetterGrade)
+		if !ok {
+			return nil, fmt.Errorf("%w %s", model.ErrInvalidGrade, *req.LetterGrade)
+		}
+	case req.Score != nil:
+		grade, ok = s.scale.ForScore(*req.Score)
+		if !ok {
+			return nil, fmt.Errorf("%w for score %v", model.ErrInvalidGrade, *req.Score)
+		}
+	default:
+		return nil, fmt.Errorf("%w, a letter grade or a score is required", model.ErrInvalidGrade)
+	}
+
+	now := time.Now()
+
+	//grading an enrollment also completes it, which is what prerequisites look at
+	res, err := s.conn.ExecContext(ctx, `UPDATE student_courses SET grade = ?, score = ?, grade_points = ?, graded_by = ?, graded_at = ?, completed_at = COALESCE(completed_at, ?)
+		WHERE student_id = ? AND course_id = ? AND dropped_at IS NULL`,
+		grade.Letter, req.Score, grade.Points, gradedBy, now, now, studentId, courseId)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rows == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	grades, err := studentGrades(ctx, s.conn, studentId, courseId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(grades) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return &grades[0], nil
+}
+
+func (s *Store) GetStudentGrades(ctx context.Context, studentId int64) ([]model.CourseGrade, error) {
+
+	var exists int
+	err := s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM students WHERE id = ? AND deleted_at IS NULL", studentId).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return studentGrades(ctx, s.conn, studentId, 0)
+}
+
+// studentGrades returns the graded, not dropped enrollments of a student, limited to one
+// course when courseId is set.
+func studentGrades(ctx context.Context, q queryer, studentId int64, courseId int64) ([]model.CourseGrade, error) {
+
+	rows, err := q.QueryContext(ctx, `SELECT c.id, c.course_code, c.course_name, c.credits, COALESCE(c.academic_year, ''), COALESCE(c.semester, ''),
+		sc.grade, sc.score, COALESCE(sc.grade_points, 0), sc.graded_by, sc.graded_at
+		FROM student_courses sc JOIN courses c ON c.id = sc.course_id
+		WHERE sc.student_id = ? AND sc.dropped_at IS NULL AND sc.grade IS NOT NULL AND (? = 0 OR sc.course_id = ?)
+		ORDER BY c.academic_year, sc.completed_at, c.course_code`, studentId, courseId, courseId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var grades []model.CourseGrade
+
+	for rows.Next() {
+		var grade model.CourseGrade
+		var score sql.NullFloat64
+		var gradedBy sql.NullInt64
+		var gradedAt sql.NullTime
+		err := rows.Scan(&grade.CourseId, &grade.CourseCode, &grade.CourseName, &grade.Credits, &grade.AcademicYear, &grade.Semester,
+			&grade.LetterGrade, &score, &grade.GradePoints, &gradedBy, &gradedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if score.Valid {
+			grade.Score = &score.Float64
+		}
+		grade.GradedBy = gradedBy.Int64
+		if gradedAt.Valid {
+			grade.GradedAt = &gradedAt.Time
+		}
+
+		grades = append(grades, grade)
+	}
+
+	return grades, rows.Err()
+}
+
+//transcripts
+
+// SaveTranscript stores an issued transcript, issuing the same one twice within a second is a no-op.
+func (s *Store) SaveTranscript(ctx context.Context, transcript model.Transcript) error {
+
+	content, err := json.Marshal(transcript)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn.ExecContext(ctx, "INSERT INTO transcripts (hash, student_id, issued_by, issued_at, content) VALUES (?, ?, ?, ?, ?) ON CONFLICT (hash) DO NOTHING",
+		transcript.VerificationHash, transcript.StudentId, transcript.IssuedBy, transcript.IssuedAt, string(content))
+
+	return err
+}
+
+func (s *Store) GetTranscriptByHash(ctx context.Context, hash string) (*model.Transcript, error) {
+
+	var content string
+	err := s.conn.QueryRowContext(ctx, "SELECT content FROM transcripts WHERE hash = ?", hash).Scan(&content)
+	if err != nil {
+		return nil, err
+	}
+
+	var transcript model.Transcript
+	if err := json.Unmarshal([]byte(content), &transcript); err != nil {
+		return nil, fmt.Errorf("invalid transcript content: %w", err)
+	}
+
+	return &transcript, nil
+}
+
+func (s *Store) GetStudentTranscripts(ctx context.Context, studentId int64) ([]model.Transcript, error) {
+
+	rows, err := s.conn.QueryContext(ctx, "SELECT content FROM transcripts WHERE student_id = ? ORDER BY issued_at DESC, hash", studentId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	transcripts := []model.Transcript{}
+
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			return nil, err
+		}
+
+		var transcript model.Transcript
+		if err := json.Unmarshal([]byte(content), &transcript); err != nil {
+			return nil, fmt.Errorf("invalid transcript content: %w", err)
+		}
+
+		transcripts = append(transcripts, transcript)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return transcripts, nil
+}
+
+//attendance
+
+func (s *Store) CreateCourseSession(ctx context.Context, courseId int64, session model.CourseSession) (*model.CourseSession, error) {
+
+	var exists int
+	err := s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM courses WHERE id = ?", courseId).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	session.CourseId = courseId
+	session.CreatedAt = time.Now()
+
+	session.Id, err = s.conn.insert(ctx, "INSERT INTO course_sessions (course_id, session_date, start_time, end_time, room, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		session.CourseId, session.Date, session.StartTime, session.EndTime, session.Room, session.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (s *Store) GetCourseSessions(ctx context.Context, courseId int64) ([]model.CourseSession, error) {
+
+	var exists int
+	err := s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM courses WHERE id = ?", courseId).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := s.conn.QueryContext(ctx, "SELECT id, course_id, session_date, start_time, end_time, COALESCE(room, ''), created_at FROM course_sessions WHERE course_id = ? ORDER BY session_date, start_time, id", courseId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var sessions []model.CourseSession
+
+	for rows.Next() {
+		var session model.CourseSession
+		err := rows.Scan(&session.Id, &session.CourseId, &session.Date, &session.StartTime, &session.EndTime, &session.Room, &session.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *Store) DeleteCourseSession(ctx context.Context, courseId int64, sessionId int64) error {
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	//attendance does not cascade from its session, it goes first
+	_, err = tx.ExecContext(ctx, "DELETE FROM attendance WHERE session_id = ? AND session_id IN (SELECT id FROM course_sessions WHERE course_id = ?)", sessionId, courseId)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM course_sessions WHERE id = ? AND course_id = ?", sessionId, courseId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) MarkAttendance(ctx context.Context, courseId int64, sessionId int64, req model.AttendanceRequest, markedBy int64) (*model.AttendanceResponse, error) {
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM course_sessions WHERE id = ? AND course_id = ?", sessionId, courseId).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	enrolled, err := activeEnrollments(ctx, tx, courseId)
+	if err != nil {
+		return nil, err
+	}
+
+	marks := attendanceMarks(req, enrolled)
+
+	result := model.AttendanceResponse{SessionId: sessionId}
+	now := time.Now()
+
+	for _, mark := range marks {
+		if !enrolled[mark.StudentId] {
+			result.Failed = append(result.Failed, model.AttendanceFail{
+				StudentId: mark.StudentId,
+				Code:      model.EnrollErrNotEnrolled,
+				Error:     fmt.Sprintf("student %d is not enrolled in course %d", mark.StudentId, courseId),
+			})
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO attendance (session_id, student_id, status, note, marked_by, marked_at) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (session_id, student_id) DO UPDATE SET status = excluded.status, note = excluded.note, marked_by = excluded.marked_by, marked_at = excluded.marked_at`,
+			sessionId, mark.StudentId, mark.Status, mark.Note, markedBy, now)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Marked = append(result.Marked, model.AttendanceRecord{
+			SessionId: sessionId,
+			StudentId: mark.StudentId,
+			Status:    mark.Status,
+			Note:      mark.Note,
+			MarkedBy:  markedBy,
+			MarkedAt:  now,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (s *Store) GetSessionAttendance(ctx context.Context, courseId int64, sessionId int64) ([]model.AttendanceRecord, error) {
+
+	var exists int
+	err := s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM course_sessions WHERE id = ? AND course_id = ?", sessionId, courseId).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := s.conn.QueryContext(ctx, `SELECT a.session_id, a.student_id, st.name, a.status, COALESCE(a.note, ''), COALESCE(a.marked_by, 0), a.marked_at
+		FROM attendance a JOIN students st ON st.id = a.student_id
+		WHERE a.session_id = ? ORDER BY st.name, a.student_id`, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var records []model.AttendanceRecord
+
+	for rows.Next() {
+		var record model.AttendanceRecord
+		err := rows.Scan(&record.SessionId, &record.StudentId, &record.StudentName, &record.Status, &record.Note, &record.MarkedBy, &record.MarkedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+func (s *Store) GetCourseAttendance(ctx context.Context, courseId int64) ([]model.AttendanceSummary, error) {
+
+	var exists int
+	err := s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM courses WHERE id = ?", courseId).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return attendanceSummaries(ctx, s.conn, "sc.course_id = ?", courseId)
+}
+
+func (s *Store) GetStudentAttendance(ctx context.Context, studentId int64) ([]model.AttendanceSummary, error) {
+
+	var exists int
+	err := s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM students WHERE id = ? AND deleted_at IS NULL", studentId).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return attendanceSummaries(ctx, s.conn, "sc.student_id = ?", studentId)
+}
+
+// activeEnrollments returns the students that are currently enrolled in the course, only
+// they can be marked.
+func activeEnrollments(ctx context.Context, tx *transaction, courseId int64) (map[int64]bool, error) {
+
+	rows, err := tx.QueryContext(ctx, `SELECT sc.student_id FROM student_courses sc JOIN students st ON st.id = sc.student_id
+		WHERE sc.course_id = ? AND sc.dropped_at IS NULL AND st.deleted_at IS NULL`+tx.lock("FOR SHARE OF sc"), courseId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	enrolled := map[int64]bool{}
+
+	for rows.Next() {
+		var studentId int64
+		if err := rows.Scan(&studentId); err != nil {
+			return nil, err
+		}
+		enrolled[studentId] = true
+	}
+
+	return enrolled, rows.Err()
+}
+
+// attendanceMarks expands the request into one mark per student, the session wide status
+// covers the enrolled students without an explicit record.
+func attendanceMarks(req model.AttendanceRequest, enrolled map[int64]bool) []model.AttendanceMark {
+
+	marks := req.Records
+	if req.Status == "" {
+		return marks
+	}
+
+	listed := map[int64]bool{}
+	for _, mark := range marks {
+		listed[mark.StudentId] = true
+	}
+
+	var rest []int64
+	for studentId := range enrolled {
+		if !listed[studentId] {
+			rest = append(rest, studentId)
+		}
+	}
+
+	sort.Slice(rest, func(i, j int) bool { return rest[i] < rest[j] })
+
+	for _, studentId := range rest {
+		marks = append(marks, model.AttendanceMark{StudentId: studentId, Status: req.Status})
+	}
+
+	return marks
+}
+
+// attendanceSummaries counts the attendance of the active enrollments matching where, one
+// row per student and course.
+func attendanceSummaries(ctx context.Context, q queryer, where string, arg int64) ([]model.AttendanceSummary, error) {
+
+	rows, err := q.QueryContext(ctx, `SELECT sc.student_id, st.name, c.id, c.course_code,
+		(SELECT COUNT(*) FROM course_sessions cs WHERE cs.course_id = c.id),
+		COUNT(CASE WHEN a.status = 'present' THEN 1 END),
+		COUNT(CASE WHEN a.status = 'late' THEN 1 END),
+		COUNT(CASE WHEN a.status = 'absent' THEN 1 END),
+		COUNT(CASE WHEN a.status = 'excused' THEN 1 END)
+		FROM student_courses sc
+		JOIN students st ON st.id = sc.student_id
+		JOIN courses c ON c.id = sc.course_id
+		LEFT JOIN course_sessions cs ON cs.course_id = sc.course_id
+		LEFT JOIN attendance a ON a.session_id = cs.id AND a.student_id = sc.student_id
+		WHERE sc.dropped_at IS NULL AND st.deleted_at IS NULL AND `+where+`
+		GROUP BY sc.student_id, st.name, c.id, c.course_code
+		ORDER BY c.course_code, st.name, sc.student_id`, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var summaries []model.AttendanceSummary
+
+	for rows.Next() {
+		var summary model.AttendanceSummary
+		err := rows.Scan(&summary.StudentId, &summary.StudentName, &summary.CourseId, &summary.CourseCode, &summary.Sessions,
+			&summary.Present, &summary.Late, &summary.Absent, &summary.Excused)
+		if err != nil {
+			return nil, err
+		}
+
+		summary.Unmarked = summary.Sessions - summary.Present - summary.Late - summary.Absent - summary.Excused
+
+		if counted := summary.Present + summary.Late + summary.Absent; counted > 0 {
+			summary.Percentage = math.Round(float64(summary.Present+summary.Late)/float64(counted)*10000) / 100
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, rows.Err()
+}
+
+//stats
+
+func (s *Store) GetStats(ctx context.Context) (model.Stats, error) {
+	var stats model.Stats
+	err := s.conn.QueryRowContext(ctx, `SELECT
+		(SELECT COUNT(*) FROM students WHERE status = 'active' AND deleted_at IS NULL),
+		(SELECT COUNT(*) FROM courses),
+		(SELECT COUNT(*) FROM student_courses WHERE dropped_at IS NULL),
+		(SELECT COUNT(*) FROM course_waitlist WHERE status = 'waiting')`).
+		Scan(&stats.ActiveStudents, &stats.Courses, &stats.ActiveEnrollments, &stats.Waitlisted)
+	if err != nil {
+		return model.Stats{}, err
+	}
+
+	return stats, nil
+}
+
+//waitlists
+
+func (s *Store) GetCourseWaitlist(ctx context.Context, courseId int64) ([]model.WaitlistEntry, error) {
+
+	var exists int
+	err := s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM courses WHERE id = ?", courseId).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := s.conn.QueryContext(ctx, "SELECT id, student_id, course_id, status, created_at, promoted_at FROM course_waitlist WHERE course_id = ? AND status = ? ORDER BY id", courseId, model.WaitlistWaiting)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []model.WaitlistEntry
+
+	for rows.Next() {
+		var entry model.WaitlistEntry
+		err := rows.Scan(&entry.Id, &entry.StudentId, &entry.CourseId, &entry.Status, &entry.CreatedAt, &entry.PromotedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Position = len(entries) + 1
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (s *Store) GetStudentWaitlist(ctx context.Context, studentId int64) ([]model.WaitlistEntry, error) {
+
+	//the position of a waiting entry is the number of entries queued before it, plus itself
+	rows, err := s.conn.QueryContext(ctx, `SELECT w.id, w.student_id, w.course_id, w.status, w.created_at, w.promoted_at,
+		(SELECT COUNT(*) FROM course_waitlist q WHERE q.course_id = w.course_id AND q.status = ? AND q.id <= w.id)
+		FROM course_waitlist w WHERE w.student_id = ? ORDER BY w.id`, model.WaitlistWaiting, studentId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []model.WaitlistEntry
+
+	for rows.Next() {
+		var entry model.WaitlistEntry
+		var position int
+		err := rows.Scan(&entry.Id, &entry.StudentId, &entry.CourseId, &entry.Status, &entry.CreatedAt, &entry.PromotedAt, &position)
+		if err != nil {
+			return nil, err
+		}
+
+		if entry.Status == model.WaitlistWaiting {
+			entry.Position = position
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// joinWaitlist queues the student for a full course. It returns nil when the student is
+// already waiting for the course.
+func joinWaitlist(ctx context.Context, tx *transaction, studentId int64, courseId int64) (*model.WaitlistEntry, error) {
+
+	var waiting int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM course_waitlist WHERE student_id = ? AND course_id = ? AND status = ?", studentId, courseId, model.WaitlistWaiting).Scan(&waiting)
+	if err != nil {
+		return nil, err
+	}
+
+	if waiting > 0 {
+		return nil, nil
+	}
+
+	entry := model.WaitlistEntry{
+		StudentId: studentId,
+		CourseId:  courseId,
+		Status:    model.WaitlistWaiting,
+		CreatedAt: time.Now(),
+	}
+
+	entry.Id, err = tx.insert(ctx, "INSERT INTO course_waitlist (student_id, course_id, status, created_at) VALUES (?, ?, ?, ?)", entry.StudentId, entry.CourseId, entry.Status, entry.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM course_waitlist WHERE course_id = ? AND status = ? AND id <= ?", courseId, model.WaitlistWaiting, entry.Id).Scan(&entry.Position)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// promoteFromWaitlist enrolls waitlisted students in queue order for as long as the course
+// has free seats, and marks their entries as promoted.
+func promoteFromWaitlist(ctx context.Context, tx *transaction, courseId int64) ([]model.WaitlistEntry, error) {
+
+	var promoted []model.WaitlistEntry
+
+	for {
+		var capacity sql.NullInt64
+		var status sql.NullString
+		err := tx.QueryRowContext(ctx, "SELECT capacity, status FROM courses WHERE id = ?"+tx.lock("FOR UPDATE"), courseId).Scan(&capacity, &status)
+		if errors.Is(err, sql.ErrNoRows) {
+			return promoted, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if status.String == "inactive" {
+			return promoted, nil
+		}
+
+		if capacity.Int64 > 0 {
+			var taken int64
+			err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM student_courses WHERE course_id = ? AND dropped_at IS NULL", courseId).Scan(&taken)
+			if err != nil {
+				return nil, err
+			}
+
+			if taken >= capacity.Int64 {
+				return promoted, nil
+			}
+		}
+
+		var entry model.WaitlistEntry
+		var deletedAt sql.NullTime
+		var studentId sql.NullInt64
+		err = tx.QueryRowContext(ctx, `SELECT w.id, w.student_id, w.course_id, w.created_at, s.id, s.deleted_at
+			FROM course_waitlist w LEFT JOIN students s ON s.id = w.student_id
+			WHERE w.course_id = ? AND w.status = ? ORDER BY w.id LIMIT 1`, courseId, model.WaitlistWaiting).
+			Scan(&entry.Id, &entry.StudentId, &entry.CourseId, &entry.CreatedAt, &studentId, &deletedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return promoted, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+
+		//students deleted while waiting give up their place
+		if !studentId.Valid || deletedAt.Valid {
+			_, err = tx.ExecContext(ctx, "UPDATE course_waitlist SET status = ? WHERE id = ?", model.WaitlistRemoved, entry.Id)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO student_courses (student_id, course_id, enrolled_at) VALUES (?, ?, ?)", entry.StudentId, courseId, now)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE course_waitlist SET status = ?, promoted_at = ? WHERE id = ?", model.WaitlistPromoted, now, entry.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		slog.Info("promoted student from waitlist", slog.Int64("student_id", entry.StudentId), slog.Int64("course_id", courseId))
+
+		entry.Status = model.WaitlistPromoted
+		entry.PromotedAt = &now
+		promoted = append(promoted, entry)
+	}
+}
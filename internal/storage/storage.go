@@ -1,32 +1,89 @@
 package storage
 
 import (
+	"context"
 	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"time"
 )
 
 type Storage interface {
 	//students
-	CreateStudent(student model.Student) (int64, error)
-	GetStudentById(id int64) (model.Student, error)
-	GetStudents() ([]model.Student, error)
-	DeleteStudentById(id int64) (int64, error)
-	UpdateStudentById(id int64, req model.StudentUpdateRequest) (int64, error)
-	SearchStudent(query string) (*[]model.Student, error)
+	CreateStudent(ctx context.Context, student model.Student) (int64, error)
+	CreateStudents(ctx context.Context, students []model.Student) ([]int64, error) // all or none, failures are *model.BatchError
+	GetStudentById(ctx context.Context, id int64) (model.Student, error)
+	GetStudents(ctx context.Context, query model.ListQuery) ([]model.Student, *model.PageMeta, error)
+	DeleteStudentById(ctx context.Context, id int64) (int64, error)
+	UpdateStudentById(ctx context.Context, id int64, req model.StudentUpdateRequest) (int64, error)
+	GetStudentByUserId(ctx context.Context, userId int64) (model.Student, error)
+	SearchStudent(ctx context.Context, query string) (*[]model.Student, error)
 
 	//users
-	CreateUser(user model.User) (int64, error)
-	IsEmailTaken(email string) (bool, error)
-	GetUserByEmail(email string) (*model.User, error)
+	CreateUser(ctx context.Context, user model.User) (int64, error)
+	IsEmailTaken(ctx context.Context, email string) (bool, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	GetUserById(ctx context.Context, id int64) (*model.User, error)
+	SetUserRole(ctx context.Context, id int64, role string) error
+
+	//tokens
+	CreateRefreshToken(ctx context.Context, token model.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldId int64, next model.RefreshToken) error
+	RevokeSession(ctx context.Context, familyId string) error
+	RevokeUserSessions(ctx context.Context, userId int64) error
+	RevokeAccessToken(ctx context.Context, jti string, userId int64, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+
+	//account tokens
+	CreateAccountToken(ctx context.Context, token model.AccountToken) error
+	ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (int64, error)
+	VerifyEmail(ctx context.Context, tokenHash string) (int64, error)
+
+	//login failures
+	GetLoginFailures(ctx context.Context, scope string, subject string) (model.LoginFailures, error)
+	RecordLoginFailure(ctx context.Context, scope string, subject string, at time.Time, since time.Time) (model.LoginFailures, error)
+	ClearLoginFailures(ctx context.Context, scope string, subject string) error
 
 	//courses
-	CreateCourse(course model.Course) (int64, error)
-	GetCourseById(id int64) (*model.Course, error)
-	GetAllCourses() ([]model.Course, error)
-	UpdateCourse(id int64, req model.CourseUpdateRequest) (*model.Course, error)
-	DeleteCourseById(id int64) (int64, error)
-	SearchCourse(query string) (*[]model.Course, error)
+	CreateCourse(ctx context.Context, course model.Course) (int64, error)
+	CreateCourses(ctx context.Context, courses []model.Course) ([]int64, error) // all or none, failures are *model.BatchError
+	GetCourseById(ctx context.Context, id int64) (*model.Course, error)
+	GetAllCourses(ctx context.Context, query model.ListQuery) ([]model.Course, *model.PageMeta, error)
+	UpdateCourse(ctx context.Context, id int64, req model.CourseUpdateRequest) (*model.Course, error)
+	DeleteCourseById(ctx context.Context, id int64) (int64, error) // model.ErrCourseHasHistory once a student enrolled
+	SearchCourse(ctx context.Context, query string) (*[]model.Course, error)
+
+	//prerequisites
+	GetCoursePrerequisites(ctx context.Context, courseId int64) ([]model.Prerequisite, error)
+	AddCoursePrerequisite(ctx context.Context, courseId int64, prerequisite model.Prerequisite) (*model.Prerequisite, error)
+	DeleteCoursePrerequisite(ctx context.Context, courseId int64, prerequisiteId int64) error
 
 	//enroll students
-	EnrollStudentInCourse(studentId int64, courses model.EnrollRequest) (*model.EnrollmentResponse, error)
-	FetchStudentWithEnrolledCourse(studentId int64) (*model.StudentWithCoursesResponse, error)
+	EnrollStudentInCourse(ctx context.Context, studentId int64, courses model.EnrollRequest) (*model.EnrollmentResponse, error)
+	FetchStudentWithEnrolledCourse(ctx context.Context, studentId int64) (*model.StudentWithCoursesResponse, error)
+	DropStudentCourses(ctx context.Context, studentId int64, req model.DropRequest) (*model.DropResponse, error)
+
+	//grades
+	RecordGrade(ctx context.Context, studentId int64, courseId int64, req model.GradeRequest, gradedBy int64) (*model.CourseGrade, error)
+	GetStudentGrades(ctx context.Context, studentId int64) ([]model.CourseGrade, error)
+
+	//transcripts
+	SaveTranscript(ctx context.Context, transcript model.Transcript) error
+	GetTranscriptByHash(ctx context.Context, hash string) (*model.Transcript, error)
+	GetStudentTranscripts(ctx context.Context, studentId int64) ([]model.Transcript, error) // newest first
+
+	//attendance
+	CreateCourseSession(ctx context.Context, courseId int64, session model.CourseSession) (*model.CourseSession, error)
+	GetCourseSessions(ctx context.Context, courseId int64) ([]model.CourseSession, error)
+	DeleteCourseSession(ctx context.Context, courseId int64, sessionId int64) error
+	MarkAttendance(ctx context.Context, courseId int64, sessionId int64, req model.AttendanceRequest, markedBy int64) (*model.AttendanceResponse, error)
+	GetSessionAttendance(ctx context.Context, courseId int64, sessionId int64) ([]model.AttendanceRecord, error)
+	GetCourseAttendance(ctx context.Context, courseId int64) ([]model.AttendanceSummary, error)
+	GetStudentAttendance(ctx context.Context, studentId int64) ([]model.AttendanceSummary, error)
+
+	//waitlists
+	GetCourseWaitlist(ctx context.Context, courseId int64) ([]model.WaitlistEntry, error)
+	GetStudentWaitlist(ctx context.Context, studentId int64) ([]model.WaitlistEntry, error)
+
+	//stats
+	GetStats(ctx context.Context) (model.Stats, error)
 }
@@ -0,0 +1,577 @@
+// Package storagetest is the conformance suite of the storage backends. Every implementation
+// of storage.Storage runs it against a freshly migrated database, so the backends can not
+// drift apart in behavior the handlers rely on.
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"github/com/ammar-nousher-ali/students-api/internal/utils"
+	"testing"
+	"time"
+)
+
+// Run runs the suite. open returns a storage on an empty, fully migrated database, it is
+// called once per subtest.
+func Run(t *testing.T, open func(t *testing.T) storage.Storage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s storage.Storage)
+	}{
+		{"Students", testStudents},
+		{"StudentPages", testStudentPages},
+		{"CreateStudentsRollsBack", testCreateStudentsRollsBack},
+		{"Users", testUsers},
+		{"Courses", testCourses},
+		{"EnrollmentFailures", testEnrollmentFailures},
+		{"EnrollmentWaitlist", testEnrollmentWaitlist},
+		{"DeleteStudentFreesSeats", testDeleteStudentFreesSeats},
+		{"PrerequisiteCycle", testPrerequisiteCycle},
+		{"FailedPrerequisite", testFailedPrerequisite},
+		{"DeleteCourse", testDeleteCourse},
+		{"Transcripts", testTranscripts},
+		{"LoginFailures", testLoginFailures},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+func newStudent(n int) model.Student {
+	return model.Student{Name: fmt.Sprintf("student %d", n), Email: fmt.Sprintf("student%d@example.com", n), Age: 18 + n}
+}
+
+func newCourse(code string, capacity int) model.Course {
+	now := time.Now()
+	return model.Course{CourseCode: code, CourseName: "course " + code, Credits: 3, Capacity: capacity, Status: "active", CreatedAt: now, UpdatedAt: now}
+}
+
+func createStudent(t *testing.T, s storage.Storage, n int) int64 {
+	t.Helper()
+	id, err := s.CreateStudent(context.Background(), newStudent(n))
+	if err != nil {
+		t.Fatalf("create student %d: %v", n, err)
+	}
+	return id
+}
+
+func createCourse(t *testing.T, s storage.Storage, code string, capacity int) int64 {
+	t.Helper()
+	id, err := s.CreateCourse(context.Background(), newCourse(code, capacity))
+	if err != nil {
+		t.Fatalf("create course %s: %v", code, err)
+	}
+	return id
+}
+
+func enroll(t *testing.T, s storage.Storage, studentId int64, courseId int64) *model.EnrollmentResponse {
+	t.Helper()
+	res, err := s.EnrollStudentInCourse(context.Background(), studentId, model.EnrollRequest{Courses: []int64{courseId}})
+	if err != nil {
+		t.Fatalf("enroll student %d in course %d: %v", studentId, courseId, err)
+	}
+	return res
+}
+
+func stats(t *testing.T, s storage.Storage) model.Stats {
+	t.Helper()
+	stats, err := s.GetStats(context.Background())
+	if err != nil {
+		t.Fatalf("get stats: %v", err)
+	}
+	return stats
+}
+
+func testStudents(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	id := createStudent(t, s, 1)
+
+	student, err := s.GetStudentById(ctx, id)
+	if err != nil {
+		t.Fatalf("get student: %v", err)
+	}
+	if student.Email != "student1@example.com" || student.Status != "active" {
+		t.Errorf("got %+v", student)
+	}
+
+	if _, err := s.CreateStudent(ctx, newStudent(1)); !errors.Is(err, model.ErrDuplicate) {
+		t.Errorf("second student with the same email: got %v, want %v", err, model.ErrDuplicate)
+	}
+
+	name := "renamed"
+	if _, err := s.UpdateStudentById(ctx, id, model.StudentUpdateRequest{Name: &name}); err != nil {
+		t.Fatalf("update student: %v", err)
+	}
+	if student, _ := s.GetStudentById(ctx, id); student.Name != name {
+		t.Errorf("name is %q after the update", student.Name)
+	}
+
+	if _, err := s.DeleteStudentById(ctx, id); err != nil {
+		t.Fatalf("delete student: %v", err)
+	}
+	if _, err := s.GetStudentById(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleted student: got %v, want sql.ErrNoRows", err)
+	}
+	if _, err := s.GetStudentById(ctx, id+100); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing student: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testStudentPages(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	for n := 1; n <= 5; n++ {
+		createStudent(t, s, n)
+	}
+
+	//newest first, two at a time, following the cursors
+	query := model.ListQuery{Limit: 2, Sort: "age", Desc: true}
+	var ages []int
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("the cursors do not end")
+		}
+
+		students, meta, err := s.GetStudents(ctx, query)
+		if err != nil {
+			t.Fatalf("get students: %v", err)
+		}
+		if meta.Total != 5 {
+			t.Errorf("total is %d, want 5", meta.Total)
+		}
+		for _, student := range students {
+			ages = append(ages, student.Age)
+		}
+
+		if meta.NextCursor == "" {
+			break
+		}
+		after, err := utils.DecodeCursor(meta.NextCursor)
+		if err != nil {
+			t.Fatalf("decode cursor: %v", err)
+		}
+		query.After = &after
+	}
+
+	want := []int{23, 22, 21, 20, 19}
+	if fmt.Sprint(ages) != fmt.Sprint(want) {
+		t.Errorf("paged ages %v, want %v", ages, want)
+	}
+}
+
+func testCreateStudentsRollsBack(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	_, err := s.CreateStudents(ctx, []model.Student{newStudent(1), newStudent(2), newStudent(1)})
+
+	var batchErr *model.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("got %v, want a *model.BatchError", err)
+	}
+	if batchErr.Index != 2 {
+		t.Errorf("failed item %d, want 2", batchErr.Index)
+	}
+
+	if got := stats(t, s).ActiveStudents; got != 0 {
+		t.Errorf("%d students were kept from the failed batch", got)
+	}
+}
+
+func testUsers(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	id, err := s.CreateUser(ctx, model.User{Name: "teacher", Email: "teacher@example.com", Password: "hash", Role: model.RoleStudent})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	taken, err := s.IsEmailTaken(ctx, "teacher@example.com")
+	if err != nil || !taken {
+		t.Errorf("email taken: got %v, %v", taken, err)
+	}
+
+	if err := s.SetUserRole(ctx, id, model.RoleTeacher); err != nil {
+		t.Fatalf("set role: %v", err)
+	}
+	user, err := s.GetUserByEmail(ctx, "teacher@example.com")
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if user.ID != id || user.Role != model.RoleTeacher {
+		t.Errorf("got %+v", user)
+	}
+
+	if err := s.SetUserRole(ctx, id+100, model.RoleTeacher); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("missing user: got %v, want sql.ErrNoRows", err)
+	}
+
+	admin := model.User{Name: "admin", Email: "admin@example.com", Password: "hash", Role: model.RoleAdmin}
+	if _, err := s.CreateUser(ctx, admin); err != nil {
+		t.Errorf("create admin: %v", err)
+	}
+}
+
+func testCourses(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	id := createCourse(t, s, "CS101", 10)
+
+	if _, err := s.CreateCourse(ctx, newCourse("CS101", 10)); !errors.Is(err, model.ErrDuplicate) {
+		t.Errorf("second course with the same code: got %v, want %v", err, model.ErrDuplicate)
+	}
+
+	credits := 4
+	code, name := "CS101", "renamed"
+	course, err := s.UpdateCourse(ctx, id, model.CourseUpdateRequest{CourseCode: &code, CourseName: &name, Credits: &credits})
+	if err != nil {
+		t.Fatalf("update course: %v", err)
+	}
+	if course.Credits != 4 || course.CourseName != name {
+		t.Errorf("got %+v", course)
+	}
+
+	if _, err := s.DeleteCourseById(ctx, id); err != nil {
+		t.Fatalf("delete course: %v", err)
+	}
+	if _, err := s.DeleteCourseById(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleted course: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testEnrollmentFailures(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	open, full, enrolled, waitlisted := createCourse(t, s, "CS101", 0), createCourse(t, s, "CS102", 1), createCourse(t, s, "CS103", 0), createCourse(t, s, "CS104", 1)
+	advanced := createCourse(t, s, "CS201", 0)
+	closed := newCourse("CS105", 0)
+	closed.Status = "inactive"
+	inactive, err := s.CreateCourse(ctx, closed)
+	if err != nil {
+		t.Fatalf("create inactive course: %v", err)
+	}
+	if _, err := s.AddCoursePrerequisite(ctx, advanced, model.Prerequisite{PrerequisiteId: open}); err != nil {
+		t.Fatalf("add prerequisite: %v", err)
+	}
+
+	other, student := createStudent(t, s, 1), createStudent(t, s, 2)
+	enroll(t, s, other, full)
+	enroll(t, s, other, waitlisted)
+	enroll(t, s, student, enrolled)
+	enroll(t, s, student, waitlisted)
+
+	missing := advanced + 100
+	res, err := s.EnrollStudentInCourse(ctx, student, model.EnrollRequest{Courses: []int64{missing, inactive, full, waitlisted, enrolled, advanced, open}})
+	if err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+
+	//every course is reported on its own and the others still go through
+	want := map[int64]string{
+		missing:    model.EnrollErrCourseNotFound,
+		inactive:   model.EnrollErrCourseInactive,
+		waitlisted: model.EnrollErrWaitlisted,
+		enrolled:   model.EnrollErrAlreadyEnrolled,
+		advanced:   model.EnrollErrPrerequisites,
+	}
+	got := make(map[int64]string, len(res.FailedCourses))
+	for _, fail := range res.FailedCourses {
+		got[fail.CourseID] = fail.Code
+	}
+	if len(got) != len(want) {
+		t.Errorf("failed courses %+v, want %v", res.FailedCourses, want)
+	}
+	for courseId, code := range want {
+		if got[courseId] != code {
+			t.Errorf("course %d: got %q, want %q", courseId, got[courseId], code)
+		}
+	}
+	if len(res.Waitlisted) != 1 || res.Waitlisted[0].CourseId != full {
+		t.Errorf("waitlisted %+v, want course %d", res.Waitlisted, full)
+	}
+	if len(res.EnrolledCourses) != 1 || res.EnrolledCourses[0] != open {
+		t.Errorf("enrolled %v, want course %d", res.EnrolledCourses, open)
+	}
+
+	res, err = s.EnrollStudentInCourse(ctx, student+100, model.EnrollRequest{Courses: []int64{open}})
+	if err != nil {
+		t.Fatalf("enroll a missing student: %v", err)
+	}
+	if len(res.FailedCourses) != 1 || res.FailedCourses[0].Code != model.EnrollErrStudentNotFound {
+		t.Errorf("missing student: %+v", res)
+	}
+}
+
+func testEnrollmentWaitlist(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	course := createCourse(t, s, "CS101", 1)
+	first, second := createStudent(t, s, 1), createStudent(t, s, 2)
+
+	if res := enroll(t, s, first, course); len(res.EnrolledCourses) != 1 {
+		t.Fatalf("first student: %+v", res)
+	}
+	if res := enroll(t, s, second, course); len(res.Waitlisted) != 1 {
+		t.Fatalf("second student was not waitlisted: %+v", res)
+	}
+	if res := enroll(t, s, second, course); len(res.FailedCourses) != 1 || res.FailedCourses[0].Code != model.EnrollErrWaitlisted {
+		t.Errorf("second student waitlisted twice: %+v", res)
+	}
+
+	dropped, err := s.DropStudentCourses(ctx, first, model.DropRequest{Courses: []int64{course}})
+	if err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+	if len(dropped.Promoted) != 1 || dropped.Promoted[0].StudentId != second {
+		t.Errorf("promoted %+v, want student %d", dropped.Promoted, second)
+	}
+
+	if got := stats(t, s); got.ActiveEnrollments != 1 || got.Waitlisted != 0 {
+		t.Errorf("got %+v after the promotion", got)
+	}
+}
+
+func testDeleteStudentFreesSeats(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	course, other := createCourse(t, s, "CS101", 1), createCourse(t, s, "CS201", 1)
+	first, second, third := createStudent(t, s, 1), createStudent(t, s, 2), createStudent(t, s, 3)
+
+	enroll(t, s, first, course)
+	enroll(t, s, second, course)
+	enroll(t, s, second, other)
+	enroll(t, s, first, other)
+
+	if _, err := s.DeleteStudentById(ctx, first); err != nil {
+		t.Fatalf("delete student: %v", err)
+	}
+
+	enrolled, err := s.FetchStudentWithEnrolledCourse(ctx, second)
+	if err != nil {
+		t.Fatalf("fetch enrollments: %v", err)
+	}
+	if len(enrolled.Courses) != 2 {
+		t.Errorf("the waitlisted student got %d seats, want both courses", len(enrolled.Courses))
+	}
+
+	waitlist, err := s.GetCourseWaitlist(ctx, other)
+	if err != nil {
+		t.Fatalf("get waitlist: %v", err)
+	}
+	for _, entry := range waitlist {
+		if entry.StudentId == first && entry.Status == model.WaitlistWaiting {
+			t.Error("the deleted student is still waiting")
+		}
+	}
+
+	//the seat of the deleted student is taken, so the next one waits
+	if res := enroll(t, s, third, course); len(res.Waitlisted) != 1 {
+		t.Errorf("third student: %+v", res)
+	}
+
+	if got := stats(t, s); got.ActiveEnrollments != 2 {
+		t.Errorf("%d active enrollments, want 2", got.ActiveEnrollments)
+	}
+}
+
+func testPrerequisiteCycle(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	a, b, c := createCourse(t, s, "A", 0), createCourse(t, s, "B", 0), createCourse(t, s, "C", 0)
+
+	if _, err := s.AddCoursePrerequisite(ctx, b, model.Prerequisite{PrerequisiteId: a}); err != nil {
+		t.Fatalf("b requires a: %v", err)
+	}
+	if _, err := s.AddCoursePrerequisite(ctx, c, model.Prerequisite{PrerequisiteId: b}); err != nil {
+		t.Fatalf("c requires b: %v", err)
+	}
+	if _, err := s.AddCoursePrerequisite(ctx, a, model.Prerequisite{PrerequisiteId: c}); !errors.Is(err, model.ErrInvalidPrerequisite) {
+		t.Errorf("a requires c: got %v, want model.ErrInvalidPrerequisite", err)
+	}
+}
+
+func testFailedPrerequisite(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	basic, advanced := createCourse(t, s, "CS101", 0), createCourse(t, s, "CS201", 0)
+	if _, err := s.AddCoursePrerequisite(ctx, advanced, model.Prerequisite{PrerequisiteId: basic}); err != nil {
+		t.Fatalf("add prerequisite: %v", err)
+	}
+
+	student := createStudent(t, s, 1)
+	enroll(t, s, student, basic)
+
+	grade := func(letter string) {
+		t.Helper()
+		if _, err := s.RecordGrade(ctx, student, basic, model.GradeRequest{LetterGrade: &letter}, 1); err != nil {
+			t.Fatalf("grade %s: %v", letter, err)
+		}
+	}
+
+	//a failed course is completed but does not count as a prerequisite without a min_grade
+	grade("F")
+	if res := enroll(t, s, student, advanced); len(res.FailedCourses) != 1 || res.FailedCourses[0].Code != model.EnrollErrPrerequisites {
+		t.Errorf("enrolled with an F: %+v", res)
+	}
+
+	grade("D-")
+	if res := enroll(t, s, student, advanced); len(res.EnrolledCourses) != 1 {
+		t.Errorf("not enrolled with a D-: %+v", res)
+	}
+}
+
+func testDeleteCourse(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	course, other, unused := createCourse(t, s, "CS101", 1), createCourse(t, s, "CS201", 0), createCourse(t, s, "CS301", 0)
+	student := createStudent(t, s, 1)
+
+	enroll(t, s, student, course)
+
+	if _, err := s.AddCoursePrerequisite(ctx, other, model.Prerequisite{PrerequisiteId: unused}); err != nil {
+		t.Fatalf("add prerequisite: %v", err)
+	}
+
+	session, err := s.CreateCourseSession(ctx, course, model.CourseSession{Date: "2025-01-06", StartTime: "09:00", EndTime: "10:00"})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if _, err := s.MarkAttendance(ctx, course, session.Id, model.AttendanceRequest{Status: model.AttendancePresent}, 0); err != nil {
+		t.Fatalf("mark attendance: %v", err)
+	}
+
+	//a course with enrollments keeps them, grades and transcripts depend on them
+	if _, err := s.DeleteCourseById(ctx, course); !errors.Is(err, model.ErrCourseHasHistory) {
+		t.Fatalf("delete course with enrollments: got %v, want %v", err, model.ErrCourseHasHistory)
+	}
+
+	attendance, err := s.GetStudentAttendance(ctx, student)
+	if err != nil {
+		t.Fatalf("get attendance: %v", err)
+	}
+	if len(attendance) != 1 || attendance[0].Present != 1 {
+		t.Errorf("the attendance of the course was not kept: %+v", attendance)
+	}
+
+	//a course without history takes its prerequisites and sessions along
+	if _, err := s.CreateCourseSession(ctx, unused, model.CourseSession{Date: "2025-01-06", StartTime: "09:00", EndTime: "10:00"}); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	if _, err := s.DeleteCourseById(ctx, unused); err != nil {
+		t.Fatalf("delete course: %v", err)
+	}
+
+	if _, err := s.DeleteCourseById(ctx, unused); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("delete a deleted course: got %v, want %v", err, sql.ErrNoRows)
+	}
+
+	if got := stats(t, s); got.ActiveEnrollments != 1 {
+		t.Errorf("got %d active enrollments, want the one of the kept course", got.ActiveEnrollments)
+	}
+
+	prerequisites, err := s.GetCoursePrerequisites(ctx, other)
+	if err != nil {
+		t.Fatalf("get prerequisites: %v", err)
+	}
+	if len(prerequisites) != 0 {
+		t.Errorf("the deleted course is still a prerequisite: %+v", prerequisites)
+	}
+
+	//deleting a single session still takes its attendance along
+	if err := s.DeleteCourseSession(ctx, course, session.Id); err != nil {
+		t.Fatalf("delete session: %v", err)
+	}
+
+	attendance, err = s.GetStudentAttendance(ctx, student)
+	if err != nil {
+		t.Fatalf("get attendance: %v", err)
+	}
+	if len(attendance) != 1 || attendance[0].Sessions != 0 || attendance[0].Present != 0 {
+		t.Errorf("the attendance of the deleted session was kept: %+v", attendance)
+	}
+}
+
+func testTranscripts(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	student, other := createStudent(t, s, 1), createStudent(t, s, 2)
+	issuedAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, issued := range []model.Transcript{
+		{StudentId: student, IssuedAt: issuedAt, VerificationHash: "first"},
+		{StudentId: student, IssuedAt: issuedAt.Add(time.Hour), VerificationHash: "second"},
+		{StudentId: other, IssuedAt: issuedAt.Add(2 * time.Hour), VerificationHash: "other"},
+	} {
+		if err := s.SaveTranscript(ctx, issued); err != nil {
+			t.Fatalf("save transcript %d: %v", i, err)
+		}
+	}
+
+	transcripts, err := s.GetStudentTranscripts(ctx, student)
+	if err != nil {
+		t.Fatalf("get transcripts: %v", err)
+	}
+	var hashes []string
+	for _, issued := range transcripts {
+		hashes = append(hashes, issued.VerificationHash)
+	}
+	if fmt.Sprint(hashes) != "[second first]" {
+		t.Errorf("got transcripts %v, want [second first]", hashes)
+	}
+
+	issued, err := s.GetTranscriptByHash(ctx, "first")
+	if err != nil {
+		t.Fatalf("get transcript: %v", err)
+	}
+	if issued.StudentId != student || !issued.IssuedAt.Equal(issuedAt) {
+		t.Errorf("got %+v", issued)
+	}
+
+	if transcripts, err := s.GetStudentTranscripts(ctx, student+100); err != nil || len(transcripts) != 0 {
+		t.Errorf("unknown student: got %v, %v", transcripts, err)
+	}
+}
+
+func testLoginFailures(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	start := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	for i := 0; i < 3; i++ {
+		if _, err := s.RecordLoginFailure(ctx, model.LoginScopeAccount, "a@example.com", start.Add(time.Duration(i)*time.Second), start.Add(-time.Hour)); err != nil {
+			t.Fatalf("record failure: %v", err)
+		}
+	}
+
+	failures, err := s.GetLoginFailures(ctx, model.LoginScopeAccount, "a@example.com")
+	if err != nil {
+		t.Fatalf("get failures: %v", err)
+	}
+	if failures.Failures != 3 {
+		t.Errorf("%d failures, want 3", failures.Failures)
+	}
+
+	//a failure after a quiet window starts the count over
+	later := start.Add(time.Hour)
+	failures, err = s.RecordLoginFailure(ctx, model.LoginScopeAccount, "a@example.com", later, later.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("record failure: %v", err)
+	}
+	if failures.Failures != 1 {
+		t.Errorf("%d failures after the window, want 1", failures.Failures)
+	}
+
+	if err := s.ClearLoginFailures(ctx, model.LoginScopeAccount, "a@example.com"); err != nil {
+		t.Fatalf("clear failures: %v", err)
+	}
+	if failures, _ := s.GetLoginFailures(ctx, model.LoginScopeAccount, "a@example.com"); failures.Failures != 0 {
+		t.Errorf("%d failures after clearing", failures.Failures)
+	}
+}
@@ -0,0 +1,83 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the claims of an access token. The user id is the subject.
+type Claims struct {
+	jwt.RegisteredClaims
+	Email     string `json:"email,omitempty"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+// Parse verifies the signature and the registered claims of an access token. Errors wrap
+// the jwt package errors, see ErrorCode.
+func (s *KeySet) Parse(tokenString string, cfg config.JWT) (*Claims, error) {
+
+	claims := &Claims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.Keyfunc,
+		jwt.WithValidMethods(s.Methods()),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.Audience),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ID == "" || claims.Role == "" {
+		return nil, fmt.Errorf("%w: jti and role are required", jwt.ErrTokenRequiredClaimMissing)
+	}
+
+	if _, err := strconv.ParseInt(claims.Subject, 10, 64); err != nil {
+		return nil, fmt.Errorf("%w: %s", jwt.ErrTokenInvalidSubject, claims.Subject)
+	}
+
+	return claims, nil
+}
+
+// Principal returns the authenticated caller described by the claims.
+func (c *Claims) Principal() model.Principal {
+	userId, _ := strconv.ParseInt(c.Subject, 10, 64)
+
+	principal := model.Principal{
+		UserID:    userId,
+		Email:     c.Email,
+		Role:      c.Role,
+		TokenID:   c.ID,
+		SessionID: c.SessionID,
+	}
+
+	if c.ExpiresAt != nil {
+		principal.ExpiresAt = c.ExpiresAt.Time
+	}
+
+	return principal
+}
+
+// ErrorCode maps an error of Parse to one of the model.TokenErr codes.
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return model.TokenErrMalformed
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return model.TokenErrSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return model.TokenErrExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return model.TokenErrNotYetValid
+	default:
+		return model.TokenErrInvalidClaim
+	}
+}
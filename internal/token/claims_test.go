@@ -0,0 +1,200 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func testKeySet(t *testing.T) (*KeySet, config.JWT, ed25519.PrivateKey) {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.JWT{
+		Issuer:     "students-api",
+		Audience:   "students-api",
+		Leeway:     10 * time.Second,
+		SigningKey: "hmac",
+		Keys: []config.JWTKey{
+			{Kid: "hmac", Algorithm: AlgHS256, Secret: testSecret},
+			{Kid: "ed", Algorithm: AlgEdDSA, PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))},
+		},
+	}
+
+	keys, err := NewKeySet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys, cfg, private
+}
+
+func validClaims(now time.Time) *Claims {
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "students-api",
+			Audience:  jwt.ClaimStrings{"students-api"},
+			Subject:   "1",
+			ID:        "jti",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+		Role: model.RoleStudent,
+	}
+}
+
+func signWith(t *testing.T, method jwt.SigningMethod, key any, kid string, claims *Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestParse(t *testing.T) {
+	keys, cfg, edKey := testKeySet(t)
+	now := time.Now()
+
+	hmac := func(change func(c *Claims)) func(t *testing.T) string {
+		return func(t *testing.T) string {
+			claims := validClaims(now)
+			change(claims)
+			return signWith(t, jwt.SigningMethodHS256, []byte(testSecret), "hmac", claims)
+		}
+	}
+	unchanged := func(c *Claims) {}
+
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+		code  string // empty when the token is valid
+	}{
+		{"valid hmac", hmac(unchanged), ""},
+		{"valid eddsa", func(t *testing.T) string {
+			return signWith(t, jwt.SigningMethodEdDSA, edKey, "ed", validClaims(now))
+		}, ""},
+		{"signed with the current key", func(t *testing.T) string {
+			signed, err := keys.Sign(validClaims(now))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return signed
+		}, ""},
+		{"expired", hmac(func(c *Claims) {
+			c.IssuedAt = jwt.NewNumericDate(now.Add(-time.Hour))
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+		}), model.TokenErrExpired},
+		{"expired within the leeway", hmac(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-5 * time.Second)) }), ""},
+		{"no expiry", hmac(func(c *Claims) { c.ExpiresAt = nil }), model.TokenErrInvalidClaim},
+		{"not valid yet", hmac(func(c *Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) }), model.TokenErrNotYetValid},
+		{"issued in the future", hmac(func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute)) }), model.TokenErrNotYetValid},
+		{"wrong issuer", hmac(func(c *Claims) { c.Issuer = "someone-else" }), model.TokenErrInvalidClaim},
+		{"wrong audience", hmac(func(c *Claims) { c.Audience = jwt.ClaimStrings{"someone-else"} }), model.TokenErrInvalidClaim},
+		{"no jti", hmac(func(c *Claims) { c.ID = "" }), model.TokenErrInvalidClaim},
+		{"no role", hmac(func(c *Claims) { c.Role = "" }), model.TokenErrInvalidClaim},
+		{"subject is not a user id", hmac(func(c *Claims) { c.Subject = "admin" }), model.TokenErrInvalidClaim},
+		{"tampered payload", func(t *testing.T) string {
+			parts := strings.Split(hmac(unchanged)(t), ".")
+			other := strings.Split(hmac(func(c *Claims) { c.Role = model.RoleAdmin })(t), ".")
+			return parts[0] + "." + other[1] + "." + parts[2]
+		}, model.TokenErrSignature},
+		{"wrong secret", func(t *testing.T) string {
+			return signWith(t, jwt.SigningMethodHS256, []byte(strings.Repeat("x", 32)), "hmac", validClaims(now))
+		}, model.TokenErrSignature},
+		{"no kid", func(t *testing.T) string {
+			return signWith(t, jwt.SigningMethodHS256, []byte(testSecret), "", validClaims(now))
+		}, model.TokenErrSignature},
+		{"unknown kid", func(t *testing.T) string {
+			return signWith(t, jwt.SigningMethodHS256, []byte(testSecret), "retired", validClaims(now))
+		}, model.TokenErrSignature},
+		{"algorithm of another key", func(t *testing.T) string {
+			return signWith(t, jwt.SigningMethodHS256, []byte(testSecret), "ed", validClaims(now))
+		}, model.TokenErrSignature},
+		{"public key used as hmac secret", func(t *testing.T) string {
+			return signWith(t, jwt.SigningMethodHS256, []byte(edKey.Public().(ed25519.PublicKey)), "ed", validClaims(now))
+		}, model.TokenErrSignature},
+		{"algorithm not configured", func(t *testing.T) string {
+			return signWith(t, jwt.SigningMethodHS512, []byte(testSecret), "hmac", validClaims(now))
+		}, model.TokenErrSignature},
+		{"unsigned", func(t *testing.T) string {
+			return signWith(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "hmac", validClaims(now))
+		}, model.TokenErrSignature},
+		{"malformed", func(t *testing.T) string { return "not.a.token" }, model.TokenErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := keys.Parse(tt.token(t), cfg)
+
+			if tt.code == "" {
+				if err != nil {
+					t.Fatalf("got %v, want a valid token", err)
+				}
+				if principal := claims.Principal(); principal.UserID != 1 || principal.TokenID != "jti" || principal.Role != model.RoleStudent {
+					t.Errorf("got principal %+v", principal)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("got a valid token, want %s", tt.code)
+			}
+			if code := ErrorCode(err); code != tt.code {
+				t.Errorf("got %s for %v, want %s", code, err, tt.code)
+			}
+		})
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{jwt.ErrTokenMalformed, model.TokenErrMalformed},
+		{jwt.ErrTokenSignatureInvalid, model.TokenErrSignature},
+		{jwt.ErrTokenUnverifiable, model.TokenErrSignature},
+		{jwt.ErrTokenExpired, model.TokenErrExpired},
+		{jwt.ErrTokenNotValidYet, model.TokenErrNotYetValid},
+		{jwt.ErrTokenUsedBeforeIssued, model.TokenErrNotYetValid},
+		{jwt.ErrTokenInvalidIssuer, model.TokenErrInvalidClaim},
+		{jwt.ErrTokenRequiredClaimMissing, model.TokenErrInvalidClaim},
+		{errors.New("anything else"), model.TokenErrInvalidClaim},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if code := ErrorCode(tt.err); code != tt.code {
+				t.Errorf("got %s, want %s", code, tt.code)
+			}
+		})
+	}
+}
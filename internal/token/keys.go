@@ -0,0 +1,264 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/config"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// HMAC secrets shorter than the output of SHA-256 weaken the signature.
+const minSecretLength = 32
+
+type key struct {
+	kid    string
+	method jwt.SigningMethod
+	sign   any // nil for verification only keys
+	verify any
+}
+
+// KeySet holds the configured JWT keys. Tokens are signed with the signing key and carry its
+// kid in the header; any key of the set verifies the tokens that name it, so old keys can
+// stay around while the tokens signed with them expire.
+type KeySet struct {
+	signing *key
+	keys    map[string]*key
+	order   []string
+}
+
+func NewKeySet(cfg config.JWT) (*KeySet, error) {
+
+	set := &KeySet{keys: map[string]*key{}}
+
+	for _, keyCfg := range cfg.Keys {
+		if keyCfg.Kid == "" {
+			return nil, fmt.Errorf("jwt key without kid")
+		}
+
+		if _, ok := set.keys[keyCfg.Kid]; ok {
+			return nil, fmt.Errorf("duplicate jwt key %s", keyCfg.Kid)
+		}
+
+		k, err := loadKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", keyCfg.Kid, err)
+		}
+
+		set.keys[k.kid] = k
+		set.order = append(set.order, k.kid)
+	}
+
+	signing, ok := set.keys[cfg.SigningKey]
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not configured", cfg.SigningKey)
+	}
+
+	if signing.sign == nil {
+		return nil, fmt.Errorf("signing key %s has no private key", cfg.SigningKey)
+	}
+
+	set.signing = signing
+
+	return set, nil
+}
+
+// Sign returns the signed token for claims, with the kid of the signing key in its header.
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.signing.method, claims)
+	token.Header["kid"] = s.signing.kid
+	return token.SignedString(s.signing.sign)
+}
+
+// Keyfunc picks the verification key named by the kid header of a token. The algorithm of
+// the token has to be the one configured for that key.
+func (s *KeySet) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no key id")
+	}
+
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %s", kid)
+	}
+
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+
+	return k.verify, nil
+}
+
+// Methods lists the algorithms of the configured keys, for jwt.WithValidMethods.
+func (s *KeySet) Methods() []string {
+	var methods []string
+	for _, kid := range s.order {
+		alg := s.keys[kid].method.Alg()
+		if !slices.Contains(methods, alg) {
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set. HMAC secrets are never published, so services
+// that only know the JWKS can not verify HS256 tokens.
+func (s *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, kid := range s.order {
+		k := s.keys[kid]
+
+		switch public := k.verify.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "RSA",
+				Kid: k.kid,
+				Use: "sig",
+				Alg: AlgRS256,
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "OKP",
+				Kid: k.kid,
+				Use: "sig",
+				Alg: AlgEdDSA,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	return jwks
+}
+
+func loadKey(cfg config.JWTKey) (*key, error) {
+
+	k := &key{kid: cfg.Kid}
+
+	switch {
+	case strings.EqualFold(cfg.Algorithm, AlgHS256):
+		secret, err := material(cfg.Secret, cfg.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("HS256 secret must be at least %d bytes", minSecretLength)
+		}
+		k.method = jwt.SigningMethodHS256
+		k.sign = secret
+		k.verify = secret
+
+	case strings.EqualFold(cfg.Algorithm, AlgRS256):
+		k.method = jwt.SigningMethodRS256
+		private, public, err := pemPair(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if private != nil {
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(private)
+			if err != nil {
+				return nil, err
+			}
+			k.sign = privateKey
+			k.verify = &privateKey.PublicKey
+		} else {
+			publicKey, err := jwt.ParseRSAPublicKeyFromPEM(public)
+			if err != nil {
+				return nil, err
+			}
+			k.verify = publicKey
+		}
+
+	case strings.EqualFold(cfg.Algorithm, AlgEdDSA):
+		k.method = jwt.SigningMethodEdDSA
+		private, public, err := pemPair(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if private != nil {
+			privateKey, err := jwt.ParseEdPrivateKeyFromPEM(private)
+			if err != nil {
+				return nil, err
+			}
+			signer, ok := privateKey.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("invalid Ed25519 private key")
+			}
+			k.sign = signer
+			k.verify = signer.Public()
+		} else {
+			publicKey, err := jwt.ParseEdPublicKeyFromPEM(public)
+			if err != nil {
+				return nil, err
+			}
+			k.verify = publicKey
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q, use HS256, RS256 or EdDSA", cfg.Algorithm)
+	}
+
+	return k, nil
+}
+
+// pemPair returns the private key PEM when there is one, the public key PEM otherwise.
+func pemPair(cfg config.JWTKey) ([]byte, []byte, error) {
+	if cfg.PrivateKey != "" || cfg.PrivateKeyFile != "" {
+		private, err := material(cfg.PrivateKey, cfg.PrivateKeyFile)
+		return private, nil, err
+	}
+
+	if cfg.PublicKey != "" || cfg.PublicKeyFile != "" {
+		public, err := material(cfg.PublicKey, cfg.PublicKeyFile)
+		return nil, public, err
+	}
+
+	return nil, nil, errors.New("a private or public key is required")
+}
+
+// material returns the inline value, or the content of file when there is no inline value.
+func material(inline string, file string) ([]byte, error) {
+	if inline != "" {
+		return []byte(inline), nil
+	}
+
+	if file == "" {
+		return nil, errors.New("key material is missing")
+	}
+
+	return os.ReadFile(file)
+}
@@ -0,0 +1,382 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"github/com/ammar-nousher-ali/students-api/internal/storage"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SystemSqlite     = "sqlite"
+	SystemPostgreSQL = "postgresql"
+)
+
+// OpenDB opens a database whose statements get spans carrying the SQL text.
+func OpenDB(driverName string, dsn string, system string) (*sql.DB, error) {
+	return otelsql.Open(driverName, dsn,
+		otelsql.WithAttributes(attribute.String("db.system", system)),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitConnectorConnect: true,
+			OmitRows:             true,
+		}),
+	)
+}
+
+// InstrumentStorage wraps storage so every call gets a span, below the span of the request
+// and above the statement spans of a database opened with OpenDB.
+func InstrumentStorage(storage storage.Storage) storage.Storage {
+	return &tracedStorage{next: storage}
+}
+
+type tracedStorage struct {
+	next storage.Storage
+}
+
+func start(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "storage."+method,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attribute.String("storage.method", method)),
+	)
+}
+
+// end is deferred by every method, err points at the named error result.
+func end(span trace.Span, err *error) {
+	if *err != nil && !errors.Is(*err, sql.ErrNoRows) {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
+
+func (s *tracedStorage) CreateStudent(ctx context.Context, student model.Student) (_ int64, err error) {
+	ctx, span := start(ctx, "CreateStudent")
+	defer end(span, &err)
+	return s.next.CreateStudent(ctx, student)
+}
+
+func (s *tracedStorage) CreateStudents(ctx context.Context, students []model.Student) (_ []int64, err error) {
+	ctx, span := start(ctx, "CreateStudents")
+	defer end(span, &err)
+	return s.next.CreateStudents(ctx, students)
+}
+
+func (s *tracedStorage) GetStudentById(ctx context.Context, id int64) (_ model.Student, err error) {
+	ctx, span := start(ctx, "GetStudentById")
+	defer end(span, &err)
+	return s.next.GetStudentById(ctx, id)
+}
+
+func (s *tracedStorage) GetStudents(ctx context.Context, query model.ListQuery) (_ []model.Student, _ *model.PageMeta, err error) {
+	ctx, span := start(ctx, "GetStudents")
+	defer end(span, &err)
+	return s.next.GetStudents(ctx, query)
+}
+
+func (s *tracedStorage) DeleteStudentById(ctx context.Context, id int64) (_ int64, err error) {
+	ctx, span := start(ctx, "DeleteStudentById")
+	defer end(span, &err)
+	return s.next.DeleteStudentById(ctx, id)
+}
+
+func (s *tracedStorage) UpdateStudentById(ctx context.Context, id int64, req model.StudentUpdateRequest) (_ int64, err error) {
+	ctx, span := start(ctx, "UpdateStudentById")
+	defer end(span, &err)
+	return s.next.UpdateStudentById(ctx, id, req)
+}
+
+func (s *tracedStorage) GetStudentByUserId(ctx context.Context, userId int64) (_ model.Student, err error) {
+	ctx, span := start(ctx, "GetStudentByUserId")
+	defer end(span, &err)
+	return s.next.GetStudentByUserId(ctx, userId)
+}
+
+func (s *tracedStorage) SearchStudent(ctx context.Context, query string) (_ *[]model.Student, err error) {
+	ctx, span := start(ctx, "SearchStudent")
+	defer end(span, &err)
+	return s.next.SearchStudent(ctx, query)
+}
+
+func (s *tracedStorage) CreateUser(ctx context.Context, user model.User) (_ int64, err error) {
+	ctx, span := start(ctx, "CreateUser")
+	defer end(span, &err)
+	return s.next.CreateUser(ctx, user)
+}
+
+func (s *tracedStorage) IsEmailTaken(ctx context.Context, email string) (_ bool, err error) {
+	ctx, span := start(ctx, "IsEmailTaken")
+	defer end(span, &err)
+	return s.next.IsEmailTaken(ctx, email)
+}
+
+func (s *tracedStorage) GetUserByEmail(ctx context.Context, email string) (_ *model.User, err error) {
+	ctx, span := start(ctx, "GetUserByEmail")
+	defer end(span, &err)
+	return s.next.GetUserByEmail(ctx, email)
+}
+
+func (s *tracedStorage) GetUserById(ctx context.Context, id int64) (_ *model.User, err error) {
+	ctx, span := start(ctx, "GetUserById")
+	defer end(span, &err)
+	return s.next.GetUserById(ctx, id)
+}
+
+func (s *tracedStorage) SetUserRole(ctx context.Context, id int64, role string) (err error) {
+	ctx, span := start(ctx, "SetUserRole")
+	defer end(span, &err)
+	return s.next.SetUserRole(ctx, id, role)
+}
+
+func (s *tracedStorage) CreateRefreshToken(ctx context.Context, token model.RefreshToken) (err error) {
+	ctx, span := start(ctx, "CreateRefreshToken")
+	defer end(span, &err)
+	return s.next.CreateRefreshToken(ctx, token)
+}
+
+func (s *tracedStorage) GetRefreshToken(ctx context.Context, tokenHash string) (_ *model.RefreshToken, err error) {
+	ctx, span := start(ctx, "GetRefreshToken")
+	defer end(span, &err)
+	return s.next.GetRefreshToken(ctx, tokenHash)
+}
+
+func (s *tracedStorage) RotateRefreshToken(ctx context.Context, oldId int64, next model.RefreshToken) (err error) {
+	ctx, span := start(ctx, "RotateRefreshToken")
+	defer end(span, &err)
+	return s.next.RotateRefreshToken(ctx, oldId, next)
+}
+
+func (s *tracedStorage) RevokeSession(ctx context.Context, familyId string) (err error) {
+	ctx, span := start(ctx, "RevokeSession")
+	defer end(span, &err)
+	return s.next.RevokeSession(ctx, familyId)
+}
+
+func (s *tracedStorage) RevokeUserSessions(ctx context.Context, userId int64) (err error) {
+	ctx, span := start(ctx, "RevokeUserSessions")
+	defer end(span, &err)
+	return s.next.RevokeUserSessions(ctx, userId)
+}
+
+func (s *tracedStorage) RevokeAccessToken(ctx context.Context, jti string, userId int64, expiresAt time.Time) (err error) {
+	ctx, span := start(ctx, "RevokeAccessToken")
+	defer end(span, &err)
+	return s.next.RevokeAccessToken(ctx, jti, userId, expiresAt)
+}
+
+func (s *tracedStorage) IsTokenRevoked(ctx context.Context, jti string) (_ bool, err error) {
+	ctx, span := start(ctx, "IsTokenRevoked")
+	defer end(span, &err)
+	return s.next.IsTokenRevoked(ctx, jti)
+}
+
+func (s *tracedStorage) CreateAccountToken(ctx context.Context, token model.AccountToken) (err error) {
+	ctx, span := start(ctx, "CreateAccountToken")
+	defer end(span, &err)
+	return s.next.CreateAccountToken(ctx, token)
+}
+
+func (s *tracedStorage) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (_ int64, err error) {
+	ctx, span := start(ctx, "ResetPassword")
+	defer end(span, &err)
+	return s.next.ResetPassword(ctx, tokenHash, passwordHash)
+}
+
+func (s *tracedStorage) VerifyEmail(ctx context.Context, tokenHash string) (_ int64, err error) {
+	ctx, span := start(ctx, "VerifyEmail")
+	defer end(span, &err)
+	return s.next.VerifyEmail(ctx, tokenHash)
+}
+
+func (s *tracedStorage) GetLoginFailures(ctx context.Context, scope string, subject string) (_ model.LoginFailures, err error) {
+	ctx, span := start(ctx, "GetLoginFailures")
+	defer end(span, &err)
+	return s.next.GetLoginFailures(ctx, scope, subject)
+}
+
+func (s *tracedStorage) RecordLoginFailure(ctx context.Context, scope string, subject string, at time.Time, since time.Time) (_ model.LoginFailures, err error) {
+	ctx, span := start(ctx, "RecordLoginFailure")
+	defer end(span, &err)
+	return s.next.RecordLoginFailure(ctx, scope, subject, at, since)
+}
+
+func (s *tracedStorage) ClearLoginFailures(ctx context.Context, scope string, subject string) (err error) {
+	ctx, span := start(ctx, "ClearLoginFailures")
+	defer end(span, &err)
+	return s.next.ClearLoginFailures(ctx, scope, subject)
+}
+
+func (s *tracedStorage) CreateCourse(ctx context.Context, course model.Course) (_ int64, err error) {
+	ctx, span := start(ctx, "CreateCourse")
+	defer end(span, &err)
+	return s.next.CreateCourse(ctx, course)
+}
+
+func (s *tracedStorage) CreateCourses(ctx context.Context, courses []model.Course) (_ []int64, err error) {
+	ctx, span := start(ctx, "CreateCourses")
+	defer end(span, &err)
+	return s.next.CreateCourses(ctx, courses)
+}
+
+func (s *tracedStorage) GetCourseById(ctx context.Context, id int64) (_ *model.Course, err error) {
+	ctx, span := start(ctx, "GetCourseById")
+	defer end(span, &err)
+	return s.next.GetCourseById(ctx, id)
+}
+
+func (s *tracedStorage) GetAllCourses(ctx context.Context, query model.ListQuery) (_ []model.Course, _ *model.PageMeta, err error) {
+	ctx, span := start(ctx, "GetAllCourses")
+	defer end(span, &err)
+	return s.next.GetAllCourses(ctx, query)
+}
+
+func (s *tracedStorage) UpdateCourse(ctx context.Context, id int64, req model.CourseUpdateRequest) (_ *model.Course, err error) {
+	ctx, span := start(ctx, "UpdateCourse")
+	defer end(span, &err)
+	return s.next.UpdateCourse(ctx, id, req)
+}
+
+func (s *tracedStorage) DeleteCourseById(ctx context.Context, id int64) (_ int64, err error) {
+	ctx, span := start(ctx, "DeleteCourseById")
+	defer end(span, &err)
+	return s.next.DeleteCourseById(ctx, id)
+}
+
+func (s *tracedStorage) SearchCourse(ctx context.Context, query string) (_ *[]model.Course, err error) {
+	ctx, span := start(ctx, "SearchCourse")
+	defer end(span, &err)
+	return s.next.SearchCourse(ctx, query)
+}
+
+func (s *tracedStorage) GetCoursePrerequisites(ctx context.Context, courseId int64) (_ []model.Prerequisite, err error) {
+	ctx, span := start(ctx, "GetCoursePrerequisites")
+	defer end(span, &err)
+	return s.next.GetCoursePrerequisites(ctx, courseId)
+}
+
+func (s *tracedStorage) AddCoursePrerequisite(ctx context.Context, courseId int64, prerequisite model.Prerequisite) (_ *model.Prerequisite, err error) {
+	ctx, span := start(ctx, "AddCoursePrerequisite")
+	defer end(span, &err)
+	return s.next.AddCoursePrerequisite(ctx, courseId, prerequisite)
+}
+
+func (s *tracedStorage) DeleteCoursePrerequisite(ctx context.Context, courseId int64, prerequisiteId int64) (err error) {
+	ctx, span := start(ctx, "DeleteCoursePrerequisite")
+	defer end(span, &err)
+	return s.next.DeleteCoursePrerequisite(ctx, courseId, prerequisiteId)
+}
+
+func (s *tracedStorage) EnrollStudentInCourse(ctx context.Context, studentId int64, courses model.EnrollRequest) (_ *model.EnrollmentResponse, err error) {
+	ctx, span := start(ctx, "EnrollStudentInCourse")
+	defer end(span, &err)
+	return s.next.EnrollStudentInCourse(ctx, studentId, courses)
+}
+
+func (s *tracedStorage) FetchStudentWithEnrolledCourse(ctx context.Context, studentId int64) (_ *model.StudentWithCoursesResponse, err error) {
+	ctx, span := start(ctx, "FetchStudentWithEnrolledCourse")
+	defer end(span, &err)
+	return s.next.FetchStudentWithEnrolledCourse(ctx, studentId)
+}
+
+func (s *tracedStorage) DropStudentCourses(ctx context.Context, studentId int64, req model.DropRequest) (_ *model.DropResponse, err error) {
+	ctx, span := start(ctx, "DropStudentCourses")
+	defer end(span, &err)
+	return s.next.DropStudentCourses(ctx, studentId, req)
+}
+
+func (s *tracedStorage) RecordGrade(ctx context.Context, studentId int64, courseId int64, req model.GradeRequest, gradedBy int64) (_ *model.CourseGrade, err error) {
+	ctx, span := start(ctx, "RecordGrade")
+	defer end(span, &err)
+	return s.next.RecordGrade(ctx, studentId, courseId, req, gradedBy)
+}
+
+func (s *tracedStorage) GetStudentGrades(ctx context.Context, studentId int64) (_ []model.CourseGrade, err error) {
+	ctx, span := start(ctx, "GetStudentGrades")
+	defer end(span, &err)
+	return s.next.GetStudentGrades(ctx, studentId)
+}
+
+func (s *tracedStorage) SaveTranscript(ctx context.Context, transcript model.Transcript) (err error) {
+	ctx, span := start(ctx, "SaveTranscript")
+	defer end(span, &err)
+	return s.next.SaveTranscript(ctx, transcript)
+}
+
+func (s *tracedStorage) GetTranscriptByHash(ctx context.Context, hash string) (_ *model.Transcript, err error) {
+	ctx, span := start(ctx, "GetTranscriptByHash")
+	defer end(span, &err)
+	return s.next.GetTranscriptByHash(ctx, hash)
+}
+
+func (s *tracedStorage) GetStudentTranscripts(ctx context.Context, studentId int64) (_ []model.Transcript, err error) {
+	ctx, span := start(ctx, "GetStudentTranscripts")
+	defer end(span, &err)
+	return s.next.GetStudentTranscripts(ctx, studentId)
+}
+
+func (s *tracedStorage) CreateCourseSession(ctx context.Context, courseId int64, session model.CourseSession) (_ *model.CourseSession, err error) {
+	ctx, span := start(ctx, "CreateCourseSession")
+	defer end(span, &err)
+	return s.next.CreateCourseSession(ctx, courseId, session)
+}
+
+func (s *tracedStorage) GetCourseSessions(ctx context.Context, courseId int64) (_ []model.CourseSession, err error) {
+	ctx, span := start(ctx, "GetCourseSessions")
+	defer end(span, &err)
+	return s.next.GetCourseSessions(ctx, courseId)
+}
+
+func (s *tracedStorage) DeleteCourseSession(ctx context.Context, courseId int64, sessionId int64) (err error) {
+	ctx, span := start(ctx, "DeleteCourseSession")
+	defer end(span, &err)
+	return s.next.DeleteCourseSession(ctx, courseId, sessionId)
+}
+
+func (s *tracedStorage) MarkAttendance(ctx context.Context, courseId int64, sessionId int64, req model.AttendanceRequest, markedBy int64) (_ *model.AttendanceResponse, err error) {
+	ctx, span := start(ctx, "MarkAttendance")
+	defer end(span, &err)
+	return s.next.MarkAttendance(ctx, courseId, sessionId, req, markedBy)
+}
+
+func (s *tracedStorage) GetSessionAttendance(ctx context.Context, courseId int64, sessionId int64) (_ []model.AttendanceRecord, err error) {
+	ctx, span := start(ctx, "GetSessionAttendance")
+	defer end(span, &err)
+	return s.next.GetSessionAttendance(ctx, courseId, sessionId)
+}
+
+func (s *tracedStorage) GetCourseAttendance(ctx context.Context, courseId int64) (_ []model.AttendanceSummary, err error) {
+	ctx, span := start(ctx, "GetCourseAttendance")
+	defer end(span, &err)
+	return s.next.GetCourseAttendance(ctx, courseId)
+}
+
+func (s *tracedStorage) GetStudentAttendance(ctx context.Context, studentId int64) (_ []model.AttendanceSummary, err error) {
+	ctx, span := start(ctx, "GetStudentAttendance")
+	defer end(span, &err)
+	return s.next.GetStudentAttendance(ctx, studentId)
+}
+
+func (s *tracedStorage) GetCourseWaitlist(ctx context.Context, courseId int64) (_ []model.WaitlistEntry, err error) {
+	ctx, span := start(ctx, "GetCourseWaitlist")
+	defer end(span, &err)
+	return s.next.GetCourseWaitlist(ctx, courseId)
+}
+
+func (s *tracedStorage) GetStudentWaitlist(ctx context.Context, studentId int64) (_ []model.WaitlistEntry, err error) {
+	ctx, span := start(ctx, "GetStudentWaitlist")
+	defer end(span, &err)
+	return s.next.GetStudentWaitlist(ctx, studentId)
+}
+
+func (s *tracedStorage) GetStats(ctx context.Context) (_ model.Stats, err error) {
+	ctx, span := start(ctx, "GetStats")
+	defer end(span, &err)
+	return s.next.GetStats(ctx)
+}
@@ -0,0 +1,149 @@
+package transcript
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/grading"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"io"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// Build groups the graded courses of a student by academic year and semester and signs
+// the result with its verification hash.
+func Build(student model.Student, grades []model.CourseGrade, issuedBy int64, issuedAt time.Time) (model.Transcript, error) {
+	report := grading.Report(student.Id, grades)
+
+	transcript := model.Transcript{
+		StudentId:      student.Id,
+		StudentName:    student.Name,
+		StudentEmail:   student.Email,
+		EnrollmentDate: student.EnrollmentDate.UTC(),
+		TotalCredits:   report.TotalCredits,
+		CumulativeGPA:  report.CumulativeGPA,
+		//the stored copy goes through json, keep only what survives the round trip
+		IssuedAt: issuedAt.UTC().Truncate(time.Second),
+		IssuedBy: issuedBy,
+	}
+
+	for _, term := range report.Terms {
+		entry := model.TranscriptTerm{TermGPA: term}
+		for _, grade := range grades {
+			if grade.AcademicYear == term.AcademicYear && grade.Semester == term.Semester {
+				entry.Courses = append(entry.Courses, grade)
+			}
+		}
+		transcript.Terms = append(transcript.Terms, entry)
+	}
+
+	hash, err := Hash(transcript)
+	if err != nil {
+		return model.Transcript{}, err
+	}
+
+	transcript.VerificationHash = hash
+
+	return transcript, nil
+}
+
+// Hash returns the hex encoded SHA-256 of the transcript without its verification hash.
+func Hash(transcript model.Transcript) (string, error) {
+	transcript.VerificationHash = ""
+
+	content, err := json.Marshal(transcript)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify reports whether the verification hash of the transcript still matches its content.
+func Verify(transcript model.Transcript) bool {
+	hash, err := Hash(transcript)
+	return err == nil && hash == transcript.VerificationHash
+}
+
+// WritePDF renders the transcript as an A4 PDF document.
+func WritePDF(w io.Writer, transcript model.Transcript) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Official Transcript", true)
+	pdf.SetAutoPageBreak(true, 20)
+
+	//the core fonts are not unicode, names with accents need to be translated
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Verification hash: %s", transcript.VerificationHash), "", 1, "C", false, 0, "")
+		pdf.CellFormat(0, 5, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AliasNbPages("")
+
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 10, "Official Transcript", "", 1, "C", false, 0, "")
+	pdf.Ln(4)
+
+	pdf.SetFont("Helvetica", "", 10)
+	info := [][2]string{
+		{"Student", tr(transcript.StudentName)},
+		{"Student ID", fmt.Sprint(transcript.StudentId)},
+		{"Email", transcript.StudentEmail},
+		{"Enrolled", transcript.EnrollmentDate.Format("2006-01-02")},
+		{"Issued", transcript.IssuedAt.Format("2006-01-02 15:04 MST")},
+	}
+	for _, line := range info {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(30, 6, line[0], "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, 6, line[1], "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	widths := []float64{30, 90, 20, 20, 20}
+	headers := []string{"Code", "Course", "Credits", "Grade", "Points"}
+
+	if len(transcript.Terms) == 0 {
+		pdf.SetFont("Helvetica", "I", 10)
+		pdf.CellFormat(0, 8, "No completed courses.", "", 1, "L", false, 0, "")
+	}
+
+	for _, term := range transcript.Terms {
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.CellFormat(0, 8, tr(fmt.Sprintf("%s %s", term.AcademicYear, term.Semester)), "", 1, "L", false, 0, "")
+
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.SetFillColor(230, 230, 230)
+		for i, header := range headers {
+			pdf.CellFormat(widths[i], 7, header, "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+
+		pdf.SetFont("Helvetica", "", 9)
+		for _, course := range term.Courses {
+			pdf.CellFormat(widths[0], 6, tr(course.CourseCode), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(widths[1], 6, tr(course.CourseName), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(widths[2], 6, fmt.Sprint(course.Credits), "1", 0, "C", false, 0, "")
+			pdf.CellFormat(widths[3], 6, course.LetterGrade, "1", 0, "C", false, 0, "")
+			pdf.CellFormat(widths[4], 6, fmt.Sprintf("%.2f", course.GradePoints), "1", 1, "C", false, 0, "")
+		}
+
+		pdf.SetFont("Helvetica", "I", 9)
+		pdf.CellFormat(0, 7, fmt.Sprintf("Term credits: %d    Term GPA: %.2f", term.Credits, term.GPA), "", 1, "R", false, 0, "")
+		pdf.Ln(2)
+	}
+
+	pdf.Ln(2)
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 7, fmt.Sprintf("Total credits: %d    Cumulative GPA: %.2f", transcript.TotalCredits, transcript.CumulativeGPA), "T", 1, "R", false, 0, "")
+
+	return pdf.Output(w)
+}
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"net/http"
+)
+
+// ParseBatchMode reads the mode of a batch request from the query string, partial by default.
+func ParseBatchMode(r *http.Request) (string, error) {
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", model.BatchModePartial:
+		return model.BatchModePartial, nil
+	case model.BatchModeAtomic:
+		return model.BatchModeAtomic, nil
+	default:
+		return "", fmt.Errorf("mode must be %s or %s", model.BatchModePartial, model.BatchModeAtomic)
+	}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIP returns the address of the client that sent the request, as resolved by
+// middleware.RealIP, and the address of the peer when the request did not pass through it.
+func ClientIP(r *http.Request) string {
+	if info, ok := RequestInfoFromContext(r.Context()); ok && info.ClientIP != "" {
+		return info.ClientIP
+	}
+	return peerIP(r)
+}
+
+// ResolveClientIP returns the address of the client behind the trusted proxies. The
+// X-Forwarded-For header is only believed when the peer is a trusted proxy and is read from
+// the right, every proxy appends the address it got the request from, so the first address
+// that is not a trusted proxy is the client. Anything left of it may have been made up.
+func ResolveClientIP(r *http.Request, proxies []netip.Prefix) string {
+	client := peerIP(r)
+	if !trusted(client, proxies) {
+		return client
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+
+		if _, err := netip.ParseAddr(hop); err != nil {
+			//a broken entry ends the chain, the last trusted hop is as far as it can be followed
+			return client
+		}
+
+		client = hop
+		if !trusted(client, proxies) {
+			return client
+		}
+	}
+
+	return client
+}
+
+func trusted(ip string, proxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, proxy := range proxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// ParseListQuery reads limit, offset, cursor, sort, order and the allowed filters from the query string.
+func ParseListQuery(r *http.Request, sortFields []string, filterFields []string) (model.ListQuery, error) {
+	values := r.URL.Query()
+
+	query := model.ListQuery{
+		Limit:   DefaultPageLimit,
+		Sort:    "id",
+		Filters: map[string]string{},
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxPageLimit {
+			return query, fmt.Errorf("limit must be a number between 1 and %d", MaxPageLimit)
+		}
+		query.Limit = n
+	}
+
+	if offset := values.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return query, fmt.Errorf("offset must be a positive number")
+		}
+		query.Offset = n
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		if !slices.Contains(sortFields, sort) {
+			return query, fmt.Errorf("can not sort by %s, allowed fields are %s", sort, strings.Join(sortFields, ", "))
+		}
+		query.Sort = sort
+	}
+
+	switch strings.ToLower(values.Get("order")) {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, fmt.Errorf("order must be asc or desc")
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		if query.Offset > 0 {
+			return query, fmt.Errorf("cursor and offset can not be used together")
+		}
+		after, err := DecodeCursor(cursor)
+		if err != nil {
+			return query, err
+		}
+		//the position of a row depends on the sort, a cursor of another sort points nowhere
+		if after.Sort != query.Sort || after.Desc != query.Desc {
+			return query, fmt.Errorf("the cursor belongs to another sort or order, start again without it")
+		}
+		query.After = &after
+	}
+
+	for _, field := range filterFields {
+		if value := values.Get(field); value != "" {
+			query.Filters[field] = value
+		}
+	}
+
+	return query, nil
+}
+
+// cursor is the wire form of model.Cursor. Kind tells how Value is typed, it is empty for NULL.
+type cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Kind  string `json:"k,omitempty"`
+	Value string `json:"v,omitempty"`
+	Id    int64  `json:"i"`
+}
+
+// EncodeCursor turns the last row of a page into an opaque cursor.
+func EncodeCursor(after model.Cursor) string {
+	c := cursor{Sort: after.Sort, Desc: after.Desc, Id: after.Id}
+
+	switch v := after.Value.(type) {
+	case nil:
+	case int64:
+		c.Kind, c.Value = "int", strconv.FormatInt(v, 10)
+	case int32:
+		c.Kind, c.Value = "int", strconv.FormatInt(int64(v), 10)
+	case int:
+		c.Kind, c.Value = "int", strconv.Itoa(v)
+	case float64:
+		c.Kind, c.Value = "float", strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		c.Kind, c.Value = "time", v.Format(time.RFC3339Nano)
+	case []byte:
+		c.Kind, c.Value = "text", string(v)
+	default:
+		c.Kind, c.Value = "text", fmt.Sprint(v)
+	}
+
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeCursor(encoded string) (model.Cursor, error) {
+	invalid := fmt.Errorf("invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return model.Cursor{}, invalid
+	}
+
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Id < 1 {
+		return model.Cursor{}, invalid
+	}
+
+	after := model.Cursor{Sort: c.Sort, Desc: c.Desc, Id: c.Id}
+
+	switch c.Kind {
+	case "":
+	case "int":
+		after.Value, err = strconv.ParseInt(c.Value, 10, 64)
+	case "float":
+		after.Value, err = strconv.ParseFloat(c.Value, 64)
+	case "time":
+		after.Value, err = time.Parse(time.RFC3339Nano, c.Value)
+	case "text":
+		after.Value = c.Value
+	default:
+		err = invalid
+	}
+
+	if err != nil {
+		return model.Cursor{}, invalid
+	}
+
+	return after, nil
+}
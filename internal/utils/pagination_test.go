@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github/com/ammar-nousher-ali/students-api/internal/model"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 1, 9, 30, 15, 123456789, time.UTC)
+
+	tests := []struct {
+		name  string
+		value any
+		want  any // the value after decoding, integers all come back as int64
+	}{
+		{"null", nil, nil},
+		{"int64", int64(-42), int64(-42)},
+		{"int32", int32(7), int64(7)},
+		{"int", 19, int64(19)},
+		{"float", 3.25, 3.25},
+		{"time", at, at},
+		{"time in another zone", at.In(time.FixedZone("", 5*3600)), at},
+		{"text", "Ada Lovelace", "Ada Lovelace"},
+		{"empty text", "", ""},
+		{"text with json", `{"k":"int"}`, `{"k":"int"}`},
+		{"bytes", []byte("CS101"), "CS101"},
+	}
+
+	for _, tt := range tests {
+		for _, desc := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s desc %v", tt.name, desc), func(t *testing.T) {
+				encoded := EncodeCursor(model.Cursor{Sort: "name", Desc: desc, Value: tt.value, Id: 12})
+
+				got, err := DecodeCursor(encoded)
+				if err != nil {
+					t.Fatalf("decode %s: %v", encoded, err)
+				}
+
+				if got.Sort != "name" || got.Desc != desc || got.Id != 12 {
+					t.Errorf("got %+v", got)
+				}
+
+				if want, ok := tt.want.(time.Time); ok {
+					if value, ok := got.Value.(time.Time); !ok || !value.Equal(want) {
+						t.Errorf("got value %#v, want %v", got.Value, want)
+					}
+					return
+				}
+
+				if !reflect.DeepEqual(got.Value, tt.want) {
+					t.Errorf("got value %#v, want %#v", got.Value, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeCursorTampered(t *testing.T) {
+	encode := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":"id","i":1}`))},
+		{"not json", encode("id=1")},
+		{"truncated", EncodeCursor(model.Cursor{Sort: "id", Id: 5})[:10]},
+		{"no id", encode(`{"s":"id"}`)},
+		{"id below 1", encode(`{"s":"id","i":0}`)},
+		{"id of the wrong type", encode(`{"s":"id","i":"5"}`)},
+		{"unknown kind", encode(`{"s":"id","k":"bool","v":"true","i":5}`)},
+		{"int that is not a number", encode(`{"s":"age","k":"int","v":"1 OR 1=1","i":5}`)},
+		{"float that is not a number", encode(`{"s":"gpa","k":"float","v":"high","i":5}`)},
+		{"time that is not a time", encode(`{"s":"created_at","k":"time","v":"yesterday","i":5}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := DecodeCursor(tt.cursor); err == nil {
+				t.Errorf("decoded %+v, want an error", got)
+			}
+		})
+	}
+}
+
+func TestParseListQuery(t *testing.T) {
+	sortFields := []string{"id", "name", "age"}
+	filterFields := []string{"email", "status"}
+
+	nameCursor := EncodeCursor(model.Cursor{Sort: "name", Value: "Ada", Id: 3})
+	descCursor := EncodeCursor(model.Cursor{Sort: "name", Desc: true, Value: "Ada", Id: 3})
+
+	tests := []struct {
+		name  string
+		query string
+		want  model.ListQuery
+		err   string // part of the error, empty when the query is valid
+	}{
+		{name: "defaults", query: "", want: model.ListQuery{Limit: DefaultPageLimit, Sort: "id", Filters: map[string]string{}}},
+		{name: "limit and offset", query: "limit=10&offset=20", want: model.ListQuery{Limit: 10, Offset: 20, Sort: "id", Filters: map[string]string{}}},
+		{name: "smallest limit", query: "limit=1", want: model.ListQuery{Limit: 1, Sort: "id", Filters: map[string]string{}}},
+		{name: "largest limit", query: "limit=500", want: model.ListQuery{Limit: MaxPageLimit, Sort: "id", Filters: map[string]string{}}},
+		{name: "limit of 0", query: "limit=0", err: "limit must be"},
+		{name: "limit above the maximum", query: "limit=501", err: "limit must be"},
+		{name: "negative limit", query: "limit=-5", err: "limit must be"},
+		{name: "limit that is not a number", query: "limit=ten", err: "limit must be"},
+		{name: "offset of 0", query: "offset=0", want: model.ListQuery{Limit: DefaultPageLimit, Sort: "id", Filters: map[string]string{}}},
+		{name: "negative offset", query: "offset=-1", err: "offset must be"},
+		{name: "offset that is not a number", query: "offset=1.5", err: "offset must be"},
+		{name: "sort and order", query: "sort=name&order=DESC", want: model.ListQuery{Limit: DefaultPageLimit, Sort: "name", Desc: true, Filters: map[string]string{}}},
+		{name: "unknown sort", query: "sort=password", err: "can not sort by password"},
+		{name: "unknown order", query: "order=random", err: "order must be"},
+		{name: "filters", query: "email=a@example.com&status=&role=admin", want: model.ListQuery{Limit: DefaultPageLimit, Sort: "id", Filters: map[string]string{"email": "a@example.com"}}},
+		{
+			name:  "cursor",
+			query: "sort=name&limit=5&cursor=" + url.QueryEscape(nameCursor),
+			want:  model.ListQuery{Limit: 5, Sort: "name", Filters: map[string]string{}, After: &model.Cursor{Sort: "name", Value: "Ada", Id: 3}},
+		},
+		{name: "cursor of another sort", query: "sort=age&cursor=" + url.QueryEscape(nameCursor), err: "another sort or order"},
+		{name: "cursor of the default sort", query: "cursor=" + url.QueryEscape(nameCursor), err: "another sort or order"},
+		{name: "cursor of another order", query: "sort=name&cursor=" + url.QueryEscape(descCursor), err: "another sort or order"},
+		{name: "cursor with an offset", query: "sort=name&offset=5&cursor=" + url.QueryEscape(nameCursor), err: "can not be used together"},
+		{name: "tampered cursor", query: "sort=name&cursor=" + url.QueryEscape(nameCursor[:len(nameCursor)-3]), err: "invalid cursor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/students?"+tt.query, nil)
+
+			got, err := ParseListQuery(r, sortFields, filterFields)
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error with %q", err, tt.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("got %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import "context"
+
+// RequestInfo describes the request being served. The logging middleware stores it in the
+// context and inner handlers fill in what they learn, like the authenticated user.
+type RequestInfo struct {
+	ID       string
+	UserID   int64
+	ClientIP string // set by middleware.RealIP
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo returns a copy of ctx carrying info.
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFromContext returns the request info stored by the logging middleware, if any.
+func RequestInfoFromContext(ctx context.Context) (*RequestInfo, bool) {
+	info, ok := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info, ok
+}
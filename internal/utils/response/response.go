@@ -13,7 +13,9 @@ type Response struct {
 	Status  int         `json:"status"`
 	Success bool        `json:"success"`
 	Message string      `json:"message"`
+	Code    string      `json:"code,omitempty"` // machine readable reason of an error
 	Data    interface{} `json:"data"`
+	Meta    interface{} `json:"meta,omitempty"`
 }
 
 type BatchResponse struct {
@@ -50,6 +52,13 @@ func GeneralError(err error, statusCode int) Response {
 	}
 }
 
+// CodedError is a GeneralError with a stable code clients can branch on.
+func CodedError(err error, statusCode int, code string) Response {
+	resp := GeneralError(err, statusCode)
+	resp.Code = code
+	return resp
+}
+
 func GeneralResponse(msg string, statusCode int, data interface{}) Response {
 	return Response{
 		Status:  statusCode,
@@ -59,6 +68,16 @@ func GeneralResponse(msg string, statusCode int, data interface{}) Response {
 	}
 }
 
+func PaginatedResponse(msg string, statusCode int, data interface{}, meta interface{}) Response {
+	return Response{
+		Status:  statusCode,
+		Success: true,
+		Message: msg,
+		Data:    data,
+		Meta:    meta,
+	}
+}
+
 func GeneralBatchResponse(msg string, statusCode int, data []BatchData) BatchResponse {
 	return BatchResponse{
 		Status:  statusCode,
@@ -69,6 +88,16 @@ func GeneralBatchResponse(msg string, statusCode int, data []BatchData) BatchRes
 }
 
 func ValidationError(errs validator.ValidationErrors, statusCode int) Response {
+	return Response{
+		Status:  statusCode,
+		Success: false,
+		Message: ValidationMessage(errs),
+		Data:    nil,
+	}
+}
+
+// ValidationMessage describes every failed field, for responses that report several items.
+func ValidationMessage(errs validator.ValidationErrors) string {
 	var errMsgs []string
 
 	for _, err := range errs {
@@ -81,10 +110,5 @@ func ValidationError(errs validator.ValidationErrors, statusCode int) Response {
 
 	}
 
-	return Response{
-		Status:  statusCode,
-		Success: false,
-		Message: strings.Join(errMsgs, ", "),
-		Data:    nil,
-	}
+	return strings.Join(errMsgs, ", ")
 }